@@ -9,6 +9,7 @@ import (
 )
 
 func BenchmarkAnalyzeHandler(b *testing.B) {
+	needGlobals(b)
 
 	reqbody := `{"how": 2, "id": 1}`
 	w := httptest.NewRecorder()
@@ -9,6 +9,7 @@ import (
 )
 
 func TestAnalyzeHandler(t *testing.T) {
+	needGlobals(t)
 	cases := []struct {
 		name string
 		req  string
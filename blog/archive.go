@@ -0,0 +1,688 @@
+package blog
+
+/*
+ * archive: the whole blog in a zip file, to back it up or to move it
+ * to another goblog
+ *
+ *     manifest.json    the format, the version and the files below
+ *     users.json       the users and their ranks, without passwords, optional
+ *     posts/#id.json   a post with its tags, votes, comments and attachments
+ *     media/#key       the file of an attachment
+ *
+ * An import creates the posts that are not here yet with new ids. A post
+ * is the same as one here if it has the same author, title and creation
+ * time, so importing an archive again creates nothing. A post that is
+ * here with other content is a conflict, it is reported and left as it is.
+ */
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hzget/goblog/blog/blob"
+	"github.com/hzget/goblog/blog/imaging"
+)
+
+const (
+	archiveFormat = "goblog-archive"
+	// the version of the layout, raised when an older goblog
+	// could no longer read an archive
+	archiveVersion = 1
+
+	archiveManifestFile = "manifest.json"
+	archiveUsersFile    = "users.json"
+
+	// an import cannot reach the search index of the running blog
+	rebuildHint = "restart goblog with search.rebuild set to search the new posts"
+)
+
+type archiveManifest struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// the schema version of the database exported
+	Schema int64    `json:"schema"`
+	Users  string   `json:"users,omitempty"`
+	Posts  []string `json:"posts"`
+}
+
+type archivePost struct {
+	Post
+	Star        [5]int64            `json:"star"`
+	Comments    []archiveComment    `json:"comments"`
+	Attachments []archiveAttachment `json:"attachments"`
+}
+
+type archiveComment struct {
+	Id       int64     `json:"id"`
+	ParentId int64     `json:"parentid"`
+	Author   string    `json:"author"`
+	Date     time.Time `json:"date"`
+	Modified time.Time `json:"modified"`
+	Body     string    `json:"body"`
+	Deleted  bool      `json:"deleted"`
+	Status   string    `json:"status"`
+}
+
+type archiveAttachment struct {
+	Attachment
+	// the name of the content in the archive
+	File string `json:"file"`
+}
+
+// importReport tells what an import did
+type importReport struct {
+	// the id of each post of the archive here
+	Posts     map[int64]int64
+	Created   int
+	Unchanged int
+	// the users created, they have no password
+	Users     []string
+	Conflicts []string
+}
+
+func (rep *importReport) conflict(format string, a ...interface{}) {
+	rep.Conflicts = append(rep.Conflicts, fmt.Sprintf(format, a...))
+}
+
+func initArchive() {
+	getConfig()
+	initLogging()
+	initDBHandler()
+	initSchema()
+	initStores()
+	initMedia()
+	// the cached tag listings are dropped as the posts are created
+	initCache()
+	if dbcache {
+		initRedisClient()
+	}
+}
+
+// Export writes the blog to an archive:
+//
+//	export [-o file] [-users]
+func Export(args []string) error {
+
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("o", "goblog.zip", "the archive to write")
+	users := fs.Bool("users", false, "export the users and their ranks, never their passwords")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	initArchive()
+	defer closeLogFile()
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+
+	m, err := exportArchive(f, *users)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	fmt.Printf("%d posts exported to %s\n", len(m.Posts), *out)
+
+	return nil
+}
+
+// Import reads an archive into the blog:
+//
+//	import file
+func Import(args []string) error {
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: goblog import archive.zip")
+	}
+
+	initArchive()
+	defer closeLogFile()
+
+	zr, err := zip.OpenReader(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	rep, err := importArchive(&zr.Reader)
+	if rep != nil {
+		for _, c := range rep.Conflicts {
+			fmt.Println(c)
+		}
+		fmt.Printf("posts: %d created, %d unchanged, %d conflicts; users: %d created\n",
+			rep.Created, rep.Unchanged, len(rep.Conflicts), len(rep.Users))
+		if len(rep.Users) > 0 {
+			fmt.Printf("users without a password, they cannot sign in: %s\n",
+				strings.Join(rep.Users, ", "))
+		}
+		if rep.Created > 0 {
+			fmt.Println(rebuildHint)
+		}
+	}
+
+	return err
+}
+
+// exportArchive writes the archive. Each query and each post has a
+// time of its own, the export may take long.
+func exportArchive(w io.Writer, withUsers bool) (*archiveManifest, error) {
+
+	ids, err := getPostIds()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &archiveManifest{Format: archiveFormat, Version: archiveVersion, Created: time.Now()}
+	if m.Schema, err = schemaVersion(); err != nil {
+		return nil, err
+	}
+
+	zw := zip.NewWriter(w)
+
+	if withUsers {
+		users, err := getUsersInfo()
+		if err != nil {
+			return nil, err
+		}
+		if err := writeArchiveJSON(zw, archiveUsersFile, users); err != nil {
+			return nil, err
+		}
+		m.Users = archiveUsersFile
+	}
+
+	for _, id := range ids {
+		name, err := exportPost(zw, id)
+		if err != nil {
+			return nil, fmt.Errorf("post %d: %w", id, err)
+		}
+		m.Posts = append(m.Posts, name)
+	}
+
+	if err := writeArchiveJSON(zw, archiveManifestFile, m); err != nil {
+		return nil, err
+	}
+
+	return m, zw.Close()
+}
+
+// exportPost writes a post and the files of its attachments
+func getPostIds() ([]int64, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	return postStore.ListPostIds(ctx)
+}
+
+func schemaVersion() (int64, error) {
+
+	mg, err := newMigrator()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	return mg.Version(ctx)
+}
+
+func exportPost(zw *zip.Writer, id int64) (string, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), blobDuration)
+	defer cancel()
+
+	info, err := postStore.GetPostInfo(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	cs, err := commentStore.ListComments(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	as, err := attachmentStore.ListAttachments(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	ap := &archivePost{Post: info.Post, Star: info.Star}
+	for _, c := range cs {
+		ap.Comments = append(ap.Comments, archiveComment{c.Id, c.ParentId, c.Author,
+			c.Date, c.Modified, c.Body, c.Deleted, c.Status})
+	}
+
+	// oldest first, as they were uploaded
+	for i := len(as) - 1; i >= 0; i-- {
+		a := as[i]
+		name := "media/" + a.Key
+		err := copyBlob(ctx, zw, name, a.Key)
+		if err == blob.ErrNotFound {
+			Warn(fmt.Sprintf("the file of attachment %d of post %d is missing", a.Id, id))
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		ap.Attachments = append(ap.Attachments, archiveAttachment{a, name})
+	}
+
+	name := fmt.Sprintf("posts/%d.json", id)
+
+	return name, writeArchiveJSON(zw, name, ap)
+}
+
+func copyBlob(ctx context.Context, zw *zip.Writer, name, key string) error {
+
+	content, err := blobStore.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, content)
+
+	return err
+}
+
+func writeArchiveJSON(zw *zip.Writer, name string, v interface{}) error {
+
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(b)
+
+	return err
+}
+
+// archiveFiles opens the files of an archive by name
+type archiveFiles map[string]*zip.File
+
+func (af archiveFiles) read(name string) ([]byte, error) {
+
+	f, ok := af[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is missing in the archive", name)
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (af archiveFiles) readJSON(name string, v interface{}) error {
+
+	b, err := af.read(name)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+// importArchive stops at the first error, the posts imported before it
+// are kept and are found unchanged when the archive is imported again
+func importArchive(zr *zip.Reader) (*importReport, error) {
+
+	af := archiveFiles{}
+	for _, f := range zr.File {
+		af[f.Name] = f
+	}
+
+	var m archiveManifest
+	if err := af.readJSON(archiveManifestFile, &m); err != nil {
+		return nil, err
+	}
+	if m.Format != archiveFormat {
+		return nil, fmt.Errorf("not a goblog archive")
+	}
+	if m.Version > archiveVersion {
+		return nil, fmt.Errorf("archive version %d is newer than %d", m.Version, archiveVersion)
+	}
+
+	existing, err := existingPosts()
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &importReport{Posts: map[int64]int64{}}
+
+	if m.Users != "" {
+		var users []UserInfo
+		if err := af.readJSON(m.Users, &users); err != nil {
+			return rep, err
+		}
+		if err := importUsers(users, rep); err != nil {
+			return rep, err
+		}
+	}
+
+	for _, name := range m.Posts {
+		var ap archivePost
+		if err := af.readJSON(name, &ap); err != nil {
+			return rep, err
+		}
+		if err := importPost(af, &ap, existing, rep); err != nil {
+			return rep, fmt.Errorf("post %d: %w", ap.Id, err)
+		}
+	}
+
+	return rep, nil
+}
+
+// postKey identifies a post across goblogs: its author, title and
+// creation time in seconds, which is what mysql keeps of it
+func postKey(p *Post) string {
+	return p.Author + "\x00" + p.Title + "\x00" +
+		p.Date.UTC().Truncate(time.Second).Format(time.RFC3339)
+}
+
+// existingPosts returns the posts here by their key. Each post is
+// loaded in a time of its own, there may be many of them.
+func existingPosts() (map[string]*Post, error) {
+
+	ids, err := getPostIds()
+	if err != nil {
+		return nil, err
+	}
+
+	load := func(id int64) (*Post, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+		defer cancel()
+		return postStore.LoadPost(ctx, id)
+	}
+
+	posts := map[string]*Post{}
+	for _, id := range ids {
+		p, err := load(id)
+		if err != nil {
+			return nil, err
+		}
+		posts[postKey(p)] = p
+	}
+
+	return posts, nil
+}
+
+// samePost tells whether an imported post has the content of one here
+func samePost(a, b *Post) bool {
+	return a.Body == b.Body && a.Status == b.Status &&
+		a.Format == b.Format && (len(a.Tags) == 0 && len(b.Tags) == 0 || reflect.DeepEqual(a.Tags, b.Tags))
+}
+
+// importUsers creates the users not here yet. They have no password,
+// which no sign in matches.
+func importUsers(users []UserInfo, rep *importReport) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	for _, u := range users {
+		exists, err := userStore.UserExists(ctx, u.Username)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			info, err := userStore.GetUserInfo(ctx, u.Username)
+			if err != nil {
+				return err
+			}
+			if info.Rank != u.Rank {
+				rep.conflict("user %s: the rank is %s here and %s in the archive, kept",
+					u.Username, info.Rank, u.Rank)
+			}
+			continue
+		}
+
+		if err := userStore.CreateUser(ctx, u.Username, "", u.Rank); err != nil {
+			return fmt.Errorf("user %s: %w", u.Username, err)
+		}
+		rep.Users = append(rep.Users, u.Username)
+	}
+
+	return nil
+}
+
+// mediaKeyFree tells whether an imported attachment may keep its key
+func mediaKeyFree(ctx context.Context, key string) (bool, error) {
+
+	if !blob.ValidKey(key) {
+		return false, nil
+	}
+
+	_, err := attachmentStore.GetAttachmentByKey(ctx, key)
+	switch {
+	case err == sql.ErrNoRows:
+		return true, nil
+	case err != nil:
+		return false, err
+	}
+
+	return false, nil
+}
+
+// importPost creates the post with its tags, votes, comments and
+// attachments, or finds it here. The post is removed again if any of
+// it cannot be created.
+func importPost(af archiveFiles, ap *archivePost, existing map[string]*Post, rep *importReport) error {
+
+	p := ap.Post
+	key := postKey(&p)
+	if old, ok := existing[key]; ok {
+		rep.Posts[ap.Id] = old.Id
+		if samePost(old, &p) {
+			rep.Unchanged++
+		} else {
+			rep.conflict("post %d: %q of %s is post %d here with other content, kept",
+				ap.Id, p.Title, p.Author, old.Id)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), blobDuration)
+	defer cancel()
+
+	// the attachments keep their keys unless they are taken here,
+	// the body refers to a new key by the base of it
+	for i := range ap.Attachments {
+		a := &ap.Attachments[i]
+		free, err := mediaKeyFree(ctx, a.Key)
+		if err != nil {
+			return err
+		}
+		if !free {
+			k := uuid.NewString() + mediaTypes[a.Type]
+			p.Body = strings.ReplaceAll(p.Body, mediaKeyBase(a.Key), mediaKeyBase(k))
+			a.Key = k
+		}
+	}
+
+	p.Id, p.Version = 0, 0
+	if p.Format == "" {
+		p.Format = FormatText
+	}
+	if err := p.Validate(); err != nil {
+		rep.conflict("post %d: %v, skipped", ap.Id, err)
+		return nil
+	}
+
+	if err := insertImportedPost(ctx, &p); err != nil {
+		return err
+	}
+
+	var saved []Attachment
+	fail := func(err error) error {
+		// the time of the import may be over already
+		ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+		defer cancel()
+		if derr := postStore.DeletePost(ctx, p.Id); derr != nil {
+			Warn(fmt.Sprintf("fail to remove the imported post %d: %v", p.Id, derr))
+		}
+		removeTagCache(p.Tags...)
+		for _, a := range saved {
+			removeBlobs(a.blobKeys()...)
+		}
+		return err
+	}
+
+	if ap.Star != [5]int64{} {
+		if err := voteStore.SetVotes(ctx, p.Id, ap.Star); err != nil {
+			return fail(err)
+		}
+	}
+
+	// the comments are oldest first, a parent comes before its replies
+	ids := map[int64]int64{}
+	for _, ac := range ap.Comments {
+		c := &Comment{PostId: p.Id, ParentId: ids[ac.ParentId], Author: ac.Author,
+			Date: ac.Date, Modified: ac.Modified, Body: ac.Body, Status: ac.Status}
+		// a skipped comment leaves its replies at the top of the thread
+		if err := validImportedComment(c, ac.Deleted); err != nil {
+			rep.conflict("post %d: comment %d: %v, skipped", ap.Id, ac.Id, err)
+			continue
+		}
+		if err := commentStore.AddComment(ctx, c); err != nil {
+			return fail(err)
+		}
+		if ac.Deleted {
+			if err := commentStore.DeleteComment(ctx, c.Id); err != nil {
+				return fail(err)
+			}
+		}
+		ids[ac.Id] = c.Id
+	}
+
+	for _, aa := range ap.Attachments {
+		a := aa.Attachment
+		a.Id, a.PostId = 0, p.Id
+		if err := importAttachment(af, &a, aa.File); err != nil {
+			return fail(err)
+		}
+		saved = append(saved, a)
+	}
+
+	existing[key] = &p
+	rep.Posts[ap.Id] = p.Id
+	rep.Created++
+
+	return nil
+}
+
+// insertImportedPost creates the post with its times, its tags and
+// a first revision in one transaction. The search index is the one of
+// the running blog, which is rebuilt at startup with search.rebuild.
+func insertImportedPost(ctx context.Context, p *Post) error {
+
+	if p.Format == "" {
+		p.Format = FormatText
+	}
+	// a post of an archive made before the publish times was published
+	// when it was written, a draft never was
+	if p.PublishAt.IsZero() && p.Status != StatusDraft {
+		p.PublishAt = p.Date
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	r := &Revision{Author: p.Author, Date: p.Modified, Title: p.Title, Body: p.Body}
+	if _, err := postStore.SavePost(ctx, p, r); err != nil {
+		return err
+	}
+
+	// the tag listings show the published posts
+	removeTagCache(p.Tags...)
+
+	return nil
+}
+
+// validImportedComment checks an imported comment as a save does, the
+// body of a deleted comment is gone already
+func validImportedComment(c *Comment, deleted bool) error {
+
+	switch c.Status {
+	case CommentApproved, CommentPending, CommentRejected:
+	default:
+		return fmt.Errorf("invalid status %q", c.Status)
+	}
+
+	if match, _ := regexp.MatchString(regexUsername, c.Author); !match {
+		return fmt.Errorf("invalid author %q", c.Author)
+	}
+
+	if deleted {
+		return nil
+	}
+
+	return c.Validate()
+}
+
+// importAttachment saves the file of an attachment, the variants of an
+// image are made again
+func importAttachment(af archiveFiles, a *Attachment, file string) error {
+
+	data, err := af.read(file)
+	if err != nil {
+		return err
+	}
+
+	var content io.Reader = bytes.NewReader(data)
+	var variants []imaging.Resized
+	if _, ok := imageFormats[a.Type]; ok {
+		data, vs, err := cleanImage(a, content)
+		if err != nil {
+			return err
+		}
+		content, variants = bytes.NewReader(data), vs
+	}
+
+	return saveAttachment(a, content, variants)
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-redis/redis/v8"
-	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"regexp"
@@ -45,11 +45,7 @@ func (creds *Credentials) save() error {
 	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
 	defer cancel()
 
-	q := "INSERT INTO users (username, password, `rank`) VALUES (?, ?, ?)"
-
-	_, err = db.ExecContext(ctx, q, creds.Username, string(hash), "bronze")
-
-	return err
+	return userStore.CreateUser(ctx, creds.Username, string(hash), "bronze")
 }
 
 func (creds *Credentials) remove() error {
@@ -57,11 +53,7 @@ func (creds *Credentials) remove() error {
 	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
 	defer cancel()
 
-	q := "DELETE FROM users where username = ?"
-
-	_, err := db.ExecContext(ctx, q, creds.Username)
-
-	return err
+	return userStore.RemoveUser(ctx, creds.Username)
 }
 
 func checkUserExist(username string) (bool, error) {
@@ -69,11 +61,7 @@ func checkUserExist(username string) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
 	defer cancel()
 
-	var exist = false
-	q := `SELECT (count(*)>0) from users WHERE username = ?`
-	err := db.QueryRowContext(ctx, q, username).Scan(&exist)
-
-	return exist, err
+	return userStore.UserExists(ctx, username)
 }
 
 func getPassword(username string) (string, error) {
@@ -81,11 +69,7 @@ func getPassword(username string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
 	defer cancel()
 
-	var password string
-	q := `SELECT password FROM users WHERE username = ?`
-	err := db.QueryRowContext(ctx, q, username).Scan(&password)
-
-	return password, err
+	return userStore.GetPassword(ctx, username)
 }
 
 func validateHash(origin, hash string) error {
@@ -160,12 +144,27 @@ func signinHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := remoteIP(r)
+	locked, err := loginLocked(creds.Username, ip)
+	if err != nil {
+		msg := fmt.Sprintf("fail to check the lockout of user %q, %v",
+			creds.Username, err)
+		http.Error(w, encodeJsonResp(false, msg),
+			http.StatusInternalServerError)
+		return
+	}
+	if locked > 0 {
+		respondLocked(w, locked)
+		return
+	}
+
 	hash, err := getPassword(creds.Username)
+	exists := err == nil
 	switch {
 	case err == sql.ErrNoRows:
-		msg := fmt.Sprintf("no such user %v", creds.Username)
-		http.Error(w, encodeJsonResp(false, msg), http.StatusUnauthorized)
-		return
+		// it takes as long as a wrong password, so as not to tell
+		// that the user is missing
+		hash = string(dummyHash)
 	case err != nil:
 		msg := fmt.Sprintf("fail to get password for user %v, %v",
 			creds.Username, err)
@@ -175,74 +174,59 @@ func signinHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(creds.Password))
-	if err != nil {
-		msg := fmt.Sprintf("failed to validate password: %v", err)
-		http.Error(w, encodeJsonResp(false, msg), http.StatusUnauthorized)
+	if err != nil || !exists {
+		Info(fmt.Sprintf("failed signin of %s from %s", creds.Username, ip))
+		locked, err := loginFailed(creds.Username, ip)
+		switch {
+		case err != nil:
+			Warn("fail to count the failed signin: " + err.Error())
+		case locked > 0:
+			respondLocked(w, locked)
+			return
+		}
+		http.Error(w, encodeJsonResp(false, msgSigninFailed), http.StatusUnauthorized)
 		return
 	}
 
-	token := uuid.NewString()
-	err = rdb.Set(context.Background(), creds.Username, token, sessionTimeout).Err()
+	if err := unlockLogin(LockUser, creds.Username); err != nil {
+		Warn("fail to clear the failed signins of " + creds.Username + ": " + err.Error())
+	}
+
+	session, err := newSession(r, creds.Username)
 	if err != nil {
-		msg := fmt.Sprintf("fail to set token for user %q, %v",
+		msg := fmt.Sprintf("fail to create session for user %q, %v",
 			creds.Username, err)
 		http.Error(w, encodeJsonResp(false, msg),
 			http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
-		Value:   token,
-		Path:    "/",
-		Expires: time.Now().Add(sessionTimeout),
-	})
-	http.SetCookie(w, &http.Cookie{
-		Name:    "user",
-		Value:   creds.Username,
-		Path:    "/",
-		Expires: time.Now().Add(sessionTimeout),
-	})
+	if err := setSessionCookies(w, session); err != nil {
+		deleteSession(session)
+		msg := fmt.Sprintf("fail to set cookies for user %q, %v",
+			creds.Username, err)
+		http.Error(w, encodeJsonResp(false, msg),
+			http.StatusInternalServerError)
+		return
+	}
 
 	fmt.Fprintf(w, encodeJsonResp(true, "signin success"))
 }
 
+// ValidateSession returns the user of the session cookie of the request.
+// The user cookie only tells the pages who is signed in, it is not trusted.
 func ValidateSession(w http.ResponseWriter, r *http.Request) (string, error) {
-	c, err := r.Cookie("session_token")
-	switch {
-	case err == http.ErrNoCookie:
-		return "", NewRespErr(err, http.StatusUnauthorized)
-	case err != nil:
-		fmt.Printf("internal error: %v\n", err)
-		return "", NewRespErr(err, http.StatusInternalServerError)
-	}
 
-	cuser, err := r.Cookie("user")
-	switch {
-	case err == http.ErrNoCookie:
-		return "", NewRespErr(err, http.StatusUnauthorized)
-	case err != nil:
-		fmt.Printf("internal error: %v\n", err)
-		return "", NewRespErr(err, http.StatusInternalServerError)
-	}
-
-	token, err := checkKey(cuser.Value)
-	switch {
-	case err == redis.Nil:
-		return "", NewRespErr(err, http.StatusUnauthorized)
-	case err != nil:
-		fmt.Printf("internal error: %v\n", err)
-		return "", NewRespErr(err, http.StatusInternalServerError)
-	}
-
-	if token != c.Value {
-		err := fmt.Errorf("error: %v token unmatched %v != %v\n", cuser.Value, c.Value, token)
-		Info(err.Error())
-		clearCookies(w)
-		return "", NewRespErr(ErrCacheTokenUnmatch, http.StatusUnauthorized)
+	s, err := currentSession(w, r)
+	if err != nil {
+		if errors.Is(err, redis.Nil) || errors.Is(err, ErrSessionCookie) {
+			// the session expired or was revoked, or the cookie is forged
+			clearCookies(w)
+		}
+		return "", err
 	}
 
-	return cuser.Value, nil
+	return s.User, nil
 }
 
 func RespondError(w http.ResponseWriter, err error) {
@@ -272,42 +256,22 @@ func removeKey(name string) error {
 
 func logoutHandler(w http.ResponseWriter, r *http.Request) {
 
-	user, err := ValidateSession(w, r)
+	session, err := currentSession(nil, r)
 	clearCookies(w)
 	if err != nil {
 		RespondError(w, err)
 		return
 	}
 
-	err = removeKey(user)
+	err = deleteSession(session)
 	if err == nil {
 		fmt.Fprintf(w, encodeJsonResp(true, "logout success"))
 		return
 	}
 
-	err = fmt.Errorf("%v: fail to del user %v", err, user)
+	err = fmt.Errorf("%v: fail to del session of user %v", err, session.User)
 
 	fmt.Println(err)
 	http.Error(w, encodeJsonResp(false, err.Error()),
 		http.StatusInternalServerError)
 }
-
-func clearCookies(w http.ResponseWriter) {
-	expiretime := time.Now().Add(-7 * 24 * time.Hour)
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
-		Value:   "",
-		MaxAge:  -1,
-		Path:    "/",
-		Expires: expiretime,
-	})
-
-	http.SetCookie(w, &http.Cookie{
-		Name:    "user",
-		Value:   "",
-		MaxAge:  -1,
-		Path:    "/",
-		Expires: expiretime,
-	})
-
-}
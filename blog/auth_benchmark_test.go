@@ -7,13 +7,14 @@ import (
 )
 
 func BenchmarkSigninWrapper(b *testing.B) {
+	needGlobals(b)
 	// signup a new user
 	creds := Credentials{"Lucy", "123"}
 	if err := creds.save(); err != nil {
 		b.Fatal(err)
 	}
 	defer creds.remove()
-	defer removeKey(creds.Username)
+	defer deleteUserSessions(creds.Username)
 
 	handler := signinHandler
 	w := httptest.NewRecorder()
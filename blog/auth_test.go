@@ -42,6 +42,7 @@ func TestCredentialsValidate(t *testing.T) {
 }
 
 func TestCredentialsSave(t *testing.T) {
+	needGlobals(t)
 	creds := Credentials{"Jack&Lucy", "abc123"}
 	err := creds.save()
 	if err != nil {
@@ -77,6 +78,7 @@ end:
 }
 
 func TestCredentialsRemove(t *testing.T) {
+	needGlobals(t)
 	creds := Credentials{"Lily", "abc123"}
 	if err := creds.save(); err != nil {
 		t.Fatal(err)
@@ -104,6 +106,7 @@ func TestCredentialsRemove(t *testing.T) {
 }
 
 func TestVerifyCredentials(t *testing.T) {
+	needGlobals(t)
 	cases := []struct {
 		name string
 		body string
@@ -167,6 +170,7 @@ func TestVerifyCredentials(t *testing.T) {
 }
 
 func TestSignupHandler(t *testing.T) {
+	needGlobals(t)
 	body := `{"username":"Lucy", "password":"12345"}`
 	code := http.StatusOK
 	expected := jsonResp{true, "signup success"}
@@ -230,6 +234,7 @@ func testsignup(t *testing.T, body string, code int, expected *jsonResp) func(*t
 }
 
 func TestSigninHandler(t *testing.T) {
+	needGlobals(t)
 
 	// signup a new user
 	creds := Credentials{"Lucy", "123"}
@@ -243,16 +248,50 @@ func TestSigninHandler(t *testing.T) {
 	expected := jsonResp{true, "signin success"}
 	t.Run("Success", testSignin(t, body, code, &expected))
 
+	// the failed signins of the tests are not kept
+	defer unlockLogin(LockUser, "Lucya")
+	defer unlockLogin(LockUser, "Lucy")
+	defer unlockLogin(LockIP, "192.0.2.1")
+
+	// a missing user and a wrong password get the same answer
 	body = `{"username":"Lucya", "password":"123"}`
 	code = http.StatusUnauthorized
-	expected = jsonResp{false, "no such user Lucya"}
+	expected = jsonResp{false, msgSigninFailed}
 	t.Run("UserNotExist", testSignin(t, body, code, &expected))
 
 	body = `{"username":"Lucy", "password":"1234"}`
 	code = http.StatusUnauthorized
-	expected = jsonResp{false, "failed to validate password"}
+	expected = jsonResp{false, msgSigninFailed}
 	t.Run("PasswordFailed", testSignin(t, body, code, &expected))
 
+	// the failures after the free attempts lock the user out,
+	// even with the right password
+	for i := 1; i < loginUserLimit.free; i++ {
+		testSignin(t, body, http.StatusUnauthorized, nil)(t)
+	}
+	code = http.StatusTooManyRequests
+	expected = jsonResp{false, msgSigninLocked}
+	t.Run("Locked", testSignin(t, body, code, &expected))
+	t.Run("LockedRightPassword", testSignin(t, `{"username":"Lucy", "password":"123"}`, code, &expected))
+
+	t.Run("ListLockouts", func(t *testing.T) {
+		ls, err := listLockouts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range ls {
+			if l.Kind == LockUser && l.Name == "Lucy" {
+				return
+			}
+		}
+		t.Fatalf("want the lockout of Lucy, got %v", ls)
+	})
+
+	// the admin clears the lockout
+	if err := unlockLogin(LockUser, "Lucy"); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("Unlocked", testSignin(t, `{"username":"Lucy", "password":"123"}`, http.StatusOK, nil))
 }
 
 // if expected is nil, do not verify expected msg
@@ -344,33 +383,40 @@ func testSignin(t *testing.T, body string, code int, expected *jsonResp) func(*t
 		}
 
 		// check session data in datastore
-		tokenid, err := checkKey(user)
+		session, err := loadSession(tokenOf(t, token))
 		switch {
 		case err == redis.Nil:
-			t.Errorf("no session data for %s", user)
+			t.Errorf("no session data for token %s", token)
 			return
 		case err != nil:
 			t.Fatal(err)
 		}
+		defer deleteSession(session)
 
-		if token != tokenid {
-			t.Errorf("session data for %s has wrong token: "+
-				"client get %v, in datastore %v", user, token, tokenid)
+		if session.User != creds.Username {
+			t.Errorf("session of token %s has wrong user: "+
+				"want %v, in datastore %v", token, creds.Username, session.User)
 			return
 		}
-
-		defer removeKey(user)
 	}
 }
 
-func signin(t *testing.T, username, password string) {
+func signin(t *testing.T, username, password string) string {
 	body := `{"username":"` + username + `", "password":"` + password + `"}`
 	req := httptest.NewRequest("", "/signin", bytes.NewBufferString(body))
 	w := httptest.NewRecorder()
 	signinHandler(w, req)
-	if resp := w.Result(); resp.StatusCode != http.StatusOK {
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
 		t.Fatalf("signin failed, status: %d", resp.StatusCode)
 	}
+	for _, c := range resp.Cookies() {
+		if c.Name == "session_token" {
+			return c.Value
+		}
+	}
+	t.Fatalf("signin without a session_token cookie")
+	return ""
 }
 
 func doALogout(mycookie string) *http.Response {
@@ -392,6 +438,7 @@ func verifyLogoutResp(t *testing.T, resp *http.Response, code int) {
 }
 
 func TestLogoutHandler(t *testing.T) {
+	needGlobals(t)
 
 	// signup a new user
 	creds := Credentials{"Lucy", "123"}
@@ -400,49 +447,167 @@ func TestLogoutHandler(t *testing.T) {
 	}
 	defer creds.remove()
 
-	// signin
-	signin(t, "Lucy", "123")
-	token, err := checkKey("Lucy")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer removeKey("Lucy")
+	// signin on two devices
+	token := signin(t, "Lucy", "123")
+	other := signin(t, "Lucy", "123")
+	defer deleteUserSessions("Lucy")
 
 	var resp *http.Response
 
 	t.Run("Unauthorized", func(t *testing.T) {
 		resp = doALogout("session_token=2" + token + "; user=Lucy")
 		verifyLogoutResp(t, resp, http.StatusUnauthorized)
-		if _, err := checkKey("Lucy"); err != nil {
+		if _, err := loadSession(tokenOf(t, token)); err != nil {
 			t.Fatalf("expect nil, but got %v", err)
 		}
 	})
 
 	t.Run("Unauthorized", func(t *testing.T) {
-		resp = doALogout("session_token=" + token + "; user=Lucys")
-		verifyLogoutResp(t, resp, http.StatusUnauthorized)
-	})
-
-	t.Run("Unauthorized", func(t *testing.T) {
-		resp = doALogout("session_token=" + token + ";")
+		resp = doALogout("user=Lucy")
 		verifyLogoutResp(t, resp, http.StatusUnauthorized)
 	})
 
 	t.Run("StatusOK", func(t *testing.T) {
 		resp = doALogout("session_token=" + token + "; user=Lucy")
 		verifyLogoutResp(t, resp, http.StatusOK)
-		if _, err := checkKey("Lucy"); err != redis.Nil {
+		if _, err := loadSession(tokenOf(t, token)); err != redis.Nil {
 			t.Fatalf("expect redis.Nil, but got %v", err)
 		}
+		// the other device is still signed in
+		if _, err := loadSession(tokenOf(t, other)); err != nil {
+			t.Fatalf("expect the other session, but got %v", err)
+		}
 	})
 
 	t.Run("Unauthorized", func(t *testing.T) {
 		resp = doALogout("session_token=" + token + "; user=Lucy")
 		verifyLogoutResp(t, resp, http.StatusUnauthorized)
 	})
+
+	t.Run("OtherDevice", func(t *testing.T) {
+		resp = doALogout("session_token=" + other)
+		verifyLogoutResp(t, resp, http.StatusOK)
+		if ss, err := userSessions("Lucy"); err != nil || len(ss) != 0 {
+			t.Fatalf("expect no sessions, but got %v, %v", ss, err)
+		}
+	})
+}
+
+func doARevoke(handler http.HandlerFunc, body, mycookie string) *http.Response {
+	req := httptest.NewRequest("POST", "/revokesessionjs", bytes.NewBufferString(body))
+	req.Header.Set("Cookie", mycookie)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w.Result()
+}
+
+func TestRevokeSession(t *testing.T) {
+	needGlobals(t)
+
+	// signup a new user
+	creds := Credentials{"Lucy", "123"}
+	if err := creds.save(); err != nil {
+		t.Fatal(err)
+	}
+	defer creds.remove()
+
+	laptop := signin(t, "Lucy", "123")
+	phone := signin(t, "Lucy", "123")
+	tablet := signin(t, "Lucy", "123")
+	defer deleteUserSessions("Lucy")
+
+	revoke := makePageHandler(revokesessionjsHandler)
+	adminRevoke := makeAdminHandler(adminrevokejsHandler)
+
+	t.Run("List", func(t *testing.T) {
+		ss, err := userSessions("Lucy")
+		if err != nil || len(ss) != 3 {
+			t.Fatalf("expect 3 sessions, but got %v, %v", ss, err)
+		}
+	})
+
+	t.Run("NoSuchSession", func(t *testing.T) {
+		resp := doARevoke(revoke, `{"id":"`+sessionRef(tokenOf(t, laptop))+`x"}`, "session_token="+laptop)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expect http code %d, but got %d", http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+
+	t.Run("OtherDevice", func(t *testing.T) {
+		resp := doARevoke(revoke, `{"id":"`+sessionRef(tokenOf(t, phone))+`"}`, "session_token="+laptop)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expect http code %d, but got %d", http.StatusOK, resp.StatusCode)
+		}
+		if _, err := loadSession(tokenOf(t, phone)); err != redis.Nil {
+			t.Fatalf("expect redis.Nil, but got %v", err)
+		}
+		if _, err := loadSession(tokenOf(t, laptop)); err != nil {
+			t.Fatalf("expect nil, but got %v", err)
+		}
+	})
+
+	t.Run("NotAdmin", func(t *testing.T) {
+		resp := doARevoke(adminRevoke, `{"user":"Lucy"}`, "session_token="+laptop)
+		if resp.StatusCode == http.StatusOK {
+			t.Fatalf("expect an error, but got http code %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Admin", func(t *testing.T) {
+		resp := doARevoke(adminRevoke, `{"user":"Lucy","id":"`+sessionRef(tokenOf(t, tablet))+`"}`, cookie)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expect http code %d, but got %d", http.StatusOK, resp.StatusCode)
+		}
+		if _, err := loadSession(tokenOf(t, tablet)); err != redis.Nil {
+			t.Fatalf("expect redis.Nil, but got %v", err)
+		}
+	})
+
+	t.Run("Everywhere", func(t *testing.T) {
+		signin(t, "Lucy", "123")
+		resp := doARevoke(revoke, `{}`, "session_token="+laptop)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expect http code %d, but got %d", http.StatusOK, resp.StatusCode)
+		}
+		verifyClearCookies(t, resp.Cookies())
+		if ss, err := userSessions("Lucy"); err != nil || len(ss) != 0 {
+			t.Fatalf("expect no sessions, but got %v, %v", ss, err)
+		}
+	})
+}
+
+// tokenOf returns the token of the session carried by the cookie value
+func tokenOf(t *testing.T, value string) string {
+	r := httptest.NewRequest("", "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+	claims, _, err := sessionToken(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims.Token
+}
+
+// signedCookie returns a valid session cookie of the token and the user
+func signedCookie(t *testing.T, token, user string) string {
+	w := httptest.NewRecorder()
+	if err := setSessionCookies(w, &Session{Id: token, User: user, Created: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	return sessionCookie + "=" + w.Result().Cookies()[0].Value
 }
 
 func TestValidateSession(t *testing.T) {
+	needGlobals(t)
+
+	// the cookie of admin with a changed payload
+	value := strings.TrimPrefix(strings.Split(cookie, ";")[0], sessionCookie+"=")
+	parts := strings.Split(value, ".")
+	if parts[1][0] == 'A' {
+		parts[1] = "B" + parts[1][1:]
+	} else {
+		parts[1] = "A" + parts[1][1:]
+	}
+	tampered := sessionCookie + "=" + strings.Join(parts, ".")
 
 	cases := []struct {
 		name string
@@ -452,9 +617,11 @@ func TestValidateSession(t *testing.T) {
 	}{
 		{"AlreadyLogin", cookie, "admin", nil},
 		{"LackOfToken", "", "", http.ErrNoCookie},
-		{"LackOfUser", "session_token=5", "", http.ErrNoCookie},
-		{"NoSuchUser", "session_token=5; user=whoareyou", "", redis.Nil},
-		{"UnmatchToken", "session_token=5; user=admin", "", ErrCacheTokenUnmatch},
+		{"OnlyUser", "user=admin", "", http.ErrNoCookie},
+		{"Unsigned", "session_token=5", "", ErrSessionCookie},
+		{"Tampered", tampered, "", ErrSessionCookie},
+		{"NoSuchToken", signedCookie(t, "5", "admin"), "", redis.Nil},
+		{"OtherUser", signedCookie(t, tokenOf(t, value), "Lucy"), "", ErrSessionCookie},
 	}
 
 	w := httptest.NewRecorder()
@@ -476,6 +643,7 @@ func TestValidateSession(t *testing.T) {
 }
 
 func TestClearCookies(t *testing.T) {
+	needGlobals(t)
 	w := httptest.NewRecorder()
 	clearCookies(w)
 	resp := w.Result()
@@ -0,0 +1,114 @@
+// Package blob stores the content of uploaded files by key.
+//
+// The blog keeps the metadata of a file in the database and its content
+// in a Store, so the content can live on the local disk or in an object
+// storage service by plugging in another implementation.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// ErrNotFound is returned by Get when there is no blob of the key
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs by key. A key is made of letters, digits, '.', '-'
+// and '_', and does not start with a '.'.
+type Store interface {
+	// Put writes the content read from r as the blob of the key,
+	// replacing the one already there.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get opens the blob of the key, the caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob of the key. It is not an error if there
+	// is no such blob.
+	Delete(ctx context.Context, key string) error
+}
+
+var regexKey = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]{0,127}$`)
+
+// ValidKey reports whether the key can name a blob
+func ValidKey(key string) bool {
+	return regexKey.MatchString(key)
+}
+
+// FS is a Store of one file per blob in a local directory
+type FS struct {
+	dir string
+}
+
+// NewFS returns a Store in the directory, which is created if needed.
+func NewFS(dir string) (*FS, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FS{dir}, nil
+}
+
+func (fs *FS) path(key string) (string, error) {
+	if !ValidKey(key) {
+		return "", errors.New("invalid blob key " + key)
+	}
+	return filepath.Join(fs.dir, key), nil
+}
+
+// Put writes a temporary file first, so that a reader never sees
+// a blob half written.
+func (fs *FS) Put(ctx context.Context, key string, r io.Reader) error {
+
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(fs.dir, ".upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func (fs *FS) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+
+	path, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return f, err
+}
+
+func (fs *FS) Delete(ctx context.Context, key string) error {
+
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
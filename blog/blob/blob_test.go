@@ -0,0 +1,68 @@
+package blob
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFS(t *testing.T) {
+	ctx := context.Background()
+	fs, err := NewFS(t.TempDir() + "/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Put(ctx, "a.txt", strings.NewReader("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Put(ctx, "a.txt", strings.NewReader("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := fs.Get(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(b) != "second" {
+		t.Fatalf("want the blob replaced, got %q, %v", b, err)
+	}
+
+	if err := fs.Delete(ctx, "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Get(ctx, "a.txt"); err != ErrNotFound {
+		t.Fatalf("want ErrNotFound after a delete, got %v", err)
+	}
+	if err := fs.Delete(ctx, "a.txt"); err != nil {
+		t.Fatalf("want no error deleting a missing blob, got %v", err)
+	}
+}
+
+func TestValidKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		"8f14e45f-ceea-467f-a0e6-7e4c5a3f2c1d.png": true,
+		"a_b-c.tar.gz": true,
+		"":             false,
+		".hidden":      false,
+		"../passwd":    false,
+		"a/b":          false,
+		`a\b`:          false,
+		"a b":          false,
+	} {
+		if got := ValidKey(key); got != want {
+			t.Errorf("ValidKey(%q): want %v, got %v", key, want, got)
+		}
+	}
+
+	fs, err := NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Put(context.Background(), "../x", strings.NewReader("x")); err == nil {
+		t.Fatal("want an error for a key out of the directory")
+	}
+}
@@ -18,6 +18,7 @@ func Run(addr string) {
 
 	h := NewHandler()
 	h.Use(HttpLogger(nil))
+	h.Use(CsrfGuard())
 
 	var srv = &http.Server{
 		Addr:    addr,
@@ -26,9 +27,16 @@ func Run(addr string) {
 
 	var c = make(chan struct{}, 1)
 
+	ctx, stopScheduler := context.WithCancel(context.Background())
+	go runScheduler(ctx)
+
 	go startHttpServer(srv, c)
 
 	gracefullyShutdown(srv, c)
+
+	stopScheduler()
+
+	saveSearchIndex(searchIndexFile)
 }
 
 func gracefullyShutdown(srv *http.Server, c <-chan struct{}) {
@@ -62,27 +70,59 @@ func startHttpServer(srv *http.Server, c chan<- struct{}) {
 
 	http.HandleFunc(sitePrefix+"/", frontpageHandler)
 	http.HandleFunc(sitePrefix+"/postlist", postlistHandler)
+	http.HandleFunc(sitePrefix+"/tag/", tagHandler)
+	http.HandleFunc(sitePrefix+"/search", searchHandler)
 	http.HandleFunc(sitePrefix+"/view/", makeHandler(viewHandler))
 	http.HandleFunc(sitePrefix+"/edit/", makeHandler(editHandler))
 	//http.HandleFunc(sitePrefix+"/save/", makeHandler(saveHandler))
-	http.HandleFunc(sitePrefix+"/delete/", makeHandler(deleteHandler))
+	http.HandleFunc(sitePrefix+"/delete/", methods(makeHandler(deleteHandler), "POST", "DELETE"))
+	http.HandleFunc(sitePrefix+"/history/", makeHandler(historyHandler))
+	http.HandleFunc(sitePrefix+"/diff/", makeHandler(diffHandler))
 	http.Handle(sitePrefix+"/templ/rs/", http.StripPrefix(
 		sitePrefix+"/templ/rs/", http.FileServer(http.Dir("./templ/resource/"))))
 
 	http.HandleFunc(sitePrefix+"/viewjs", makePageHandler(viewjsHandler))
-	http.HandleFunc(sitePrefix+"/savejs", makePageHandler(savejsHandler))
-
-	http.HandleFunc(sitePrefix+"/signup", signupHandler)
-	http.HandleFunc(sitePrefix+"/signin", signinHandler)
-	http.HandleFunc(sitePrefix+"/logout", logoutHandler)
-
-	http.HandleFunc(sitePrefix+"/vote", voteHandler)
+	http.HandleFunc(sitePrefix+"/savejs", methods(makePageHandler(savejsHandler), "POST"))
+	http.HandleFunc(sitePrefix+"/previewjs", makePageHandler(previewjsHandler))
+	http.HandleFunc(sitePrefix+"/restorejs", methods(makePageHandler(restorejsHandler), "POST"))
+	http.HandleFunc(sitePrefix+"/searchjs", makePageHandler(searchjsHandler))
+	http.HandleFunc(sitePrefix+"/postlistjs", makePageHandler(postlistjsHandler))
+	http.HandleFunc(sitePrefix+"/commentsjs", makePageHandler(commentsjsHandler))
+	http.HandleFunc(sitePrefix+"/addcommentjs", methods(makePageHandler(addcommentjsHandler), "POST"))
+	http.HandleFunc(sitePrefix+"/editcommentjs", methods(makePageHandler(editcommentjsHandler), "POST"))
+	http.HandleFunc(sitePrefix+"/deletecommentjs", methods(makePageHandler(deletecommentjsHandler), "POST"))
+	http.HandleFunc(sitePrefix+"/upload", methods(makePageHandler(uploadHandler), "POST"))
+	http.HandleFunc(sitePrefix+"/mediajs", makePageHandler(mediajsHandler))
+	http.HandleFunc(sitePrefix+"/deletemediajs", methods(makePageHandler(deletemediajsHandler), "POST"))
+	http.HandleFunc(sitePrefix+"/media/", mediaHandler)
+	http.HandleFunc(sitePrefix+"/feed.rss", feedHandler(FeedRSS))
+	http.HandleFunc(sitePrefix+"/feed.atom", feedHandler(FeedAtom))
+	http.HandleFunc(sitePrefix+"/feed.json", feedHandler(FeedJSON))
+	http.HandleFunc(sitePrefix+"/sitemap.xml", sitemapHandler)
+	http.HandleFunc(sitePrefix+"/sitemap/", sitemapPartHandler)
+	// the crawlers look for it at the root whatever the site prefix is
+	http.HandleFunc("/robots.txt", robotsHandler)
+
+	http.HandleFunc(sitePrefix+"/signup", methods(signupHandler, "POST"))
+	http.HandleFunc(sitePrefix+"/signin", methods(signinHandler, "POST"))
+	http.HandleFunc(sitePrefix+"/logout", methods(logoutHandler, "POST"))
+	http.HandleFunc(sitePrefix+"/sessions", sessionsHandler)
+	http.HandleFunc(sitePrefix+"/sessionsjs", makePageHandler(sessionsjsHandler))
+	http.HandleFunc(sitePrefix+"/revokesessionjs", methods(makePageHandler(revokesessionjsHandler), "POST"))
+
+	http.HandleFunc(sitePrefix+"/vote", methods(voteHandler, "POST"))
 
 	http.HandleFunc(sitePrefix+"/analysis", analysisHandler)
 	http.HandleFunc(sitePrefix+"/analyze", analyzeHandler)
 
 	http.HandleFunc(sitePrefix+"/superadmin", makeAdminHandler(superadminHandler))
-	http.HandleFunc(sitePrefix+"/saveranks", makeAdminHandler(saveranksHandler))
+	http.HandleFunc(sitePrefix+"/saveranks", methods(makeAdminHandler(saveranksHandler), "POST"))
+	http.HandleFunc(sitePrefix+"/moderation", makeAdminHandler(moderationHandler))
+	http.HandleFunc(sitePrefix+"/moderatejs", methods(makeAdminHandler(moderatejsHandler), "POST"))
+	http.HandleFunc(sitePrefix+"/usersessions", makeAdminHandler(usersessionsHandler))
+	http.HandleFunc(sitePrefix+"/adminrevokejs", methods(makeAdminHandler(adminrevokejsHandler), "POST"))
+	http.HandleFunc(sitePrefix+"/lockouts", makeAdminHandler(lockoutsHandler))
+	http.HandleFunc(sitePrefix+"/unlockjs", methods(makeAdminHandler(unlockjsHandler), "POST"))
 
 	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatalf("HTTP server ListenAndServe: %v", err)
@@ -7,7 +7,11 @@ import (
 	"sync/atomic"
 )
 
-const Key_SQL_GetPostInfo = `SELECT post.*, ` +
+// the columns of a post, scanned by postFields
+const postColumns = `post.id, post.title, post.author, post.ctime, post.mtime, ` +
+	`post.body, post.version, post.status, post.publish_at, post.format`
+
+const Key_SQL_GetPostInfo = `SELECT ` + postColumns + `, ` +
 	`IFNULL(poststatistics.star1,0), ` +
 	`IFNULL(poststatistics.star2,0), ` +
 	`IFNULL(poststatistics.star3,0), ` +
@@ -18,7 +22,18 @@ const Key_SQL_GetPostInfo = `SELECT post.*, ` +
 	`ON post.id = poststatistics.postid ` +
 	`WHERE post.id = `
 
-const Key_SQL_loadPost = `select * from post where id = `
+const Key_SQL_loadPost = `select ` + postColumns + ` from post where id = `
+
+const Key_SQL_ListTagPosts = `SELECT ` + postColumns + ` FROM post ` +
+	`JOIN posttag ON post.id = posttag.postid ` +
+	`JOIN tag ON tag.id = posttag.tagid ` +
+	`WHERE post.status = 'published' AND tag.name = `
+
+const Key_SQL_TagCounts = `SELECT tag.name, count(*) FROM tag ` +
+	`JOIN posttag ON tag.id = posttag.tagid ` +
+	`JOIN post ON post.id = posttag.postid ` +
+	`WHERE post.status = 'published' ` +
+	`GROUP BY tag.name ORDER BY tag.name`
 
 var rdsUpdatingCount int64
 
@@ -21,6 +21,7 @@ func parallelRunning(N int64, fn func()) {
 }
 
 func TestAccessLimit(t *testing.T) {
+	needGlobals(t)
 	var counter int64
 	var limit int64 = 1000
 	var count int64
@@ -0,0 +1,417 @@
+package blog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hzget/goblog/blog/sanitize"
+)
+
+// Comment is a reader's reply to a post or to another comment of the post
+type Comment struct {
+	Id        int64     `json:"id"`
+	PostId    int64     `json:"postid"`
+	ParentId  int64     `json:"parentid"`
+	Author    string    `json:"author"`
+	Date      time.Time `json:"date"`
+	Modified  time.Time `json:"modified"`
+	Body      string    `json:"body"`
+	Deleted   bool      `json:"deleted"`
+	Status    string    `json:"status"`
+	Moderator string    `json:"moderator"`
+
+	// filled for the viewer when a thread is built
+	CanEdit   bool          `json:"canedit"`
+	CanDelete bool          `json:"candelete"`
+	Replies   []*Comment    `json:"replies"`
+	HTML      template.HTML `json:"html"`
+}
+
+// a pending comment waits in the moderation queue and is visible to
+// its author only. a rejected one is hidden and kept as an example of spam.
+const (
+	CommentApproved = "approved"
+	CommentPending  = "pending"
+	CommentRejected = "rejected"
+)
+
+const maxCommentLen = 2000
+
+type commentReq struct {
+	Id       int64  `json:"id"`
+	PostId   int64  `json:"postid"`
+	ParentId int64  `json:"parentid"`
+	Body     string `json:"body"`
+}
+
+type commentResp struct {
+	jsonResp
+	Id int64 `json:"id"`
+}
+
+type commentsResp struct {
+	jsonResp
+	Comments []*Comment `json:"comments"`
+}
+
+func (c *Comment) Validate() error {
+
+	if strings.TrimSpace(c.Body) == "" {
+		return errors.New("the comment is empty")
+	}
+
+	if utf8.RuneCountInString(c.Body) > maxCommentLen {
+		return fmt.Errorf("the comment is longer than %d characters", maxCommentLen)
+	}
+
+	return nil
+}
+
+func getComment(id int64) (*Comment, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	return commentStore.GetComment(ctx, id)
+}
+
+func getComments(postid int64) ([]Comment, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	return commentStore.ListComments(ctx, postid)
+}
+
+func (c *Comment) save() error {
+
+	fail := func(err error) error {
+		return fmt.Errorf("fail to save comment: %w", err)
+	}
+
+	if err := c.Validate(); err != nil {
+		return fail(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	now := time.Now()
+	c.Modified = now
+	if c.Id == 0 {
+		c.Date = now
+		if err := commentStore.AddComment(ctx, c); err != nil {
+			return fail(err)
+		}
+		return nil
+	}
+
+	if err := commentStore.UpdateComment(ctx, c); err != nil {
+		return fail(err)
+	}
+
+	return nil
+}
+
+func deleteComment(id int64) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	return commentStore.DeleteComment(ctx, id)
+}
+
+/*
+ * the permissions of a comment follow the ones of its post (postPerm):
+ * view: the post can be viewed and the comment is approved,
+ *       or the comment is pending and user == comment author
+ * edit: the post can be viewed and user == comment author
+ * del : the post can be viewed and user == comment author or post author
+ * the superadmin views and deletes every comment, whatever the status
+ * of the post or of the comment
+ */
+func getCommentPermission(postPerm int, username string, c *Comment) int {
+
+	if username == "superadmin" {
+		if c.Deleted {
+			return PermView
+		}
+		if username == c.Author {
+			return PermView | PermEdit | PermDelete
+		}
+		return PermView | PermDelete
+	}
+
+	if postPerm&PermView == 0 {
+		return PermNone
+	}
+
+	switch c.Status {
+	case CommentApproved:
+	case CommentPending:
+		if username != c.Author {
+			return PermNone
+		}
+	default:
+		return PermNone
+	}
+
+	perm := PermView
+	if c.Deleted {
+		return perm
+	}
+
+	if username == c.Author {
+		perm |= PermEdit | PermDelete
+	}
+
+	// the post author moderates the comments of the post
+	if postPerm&(PermEdit|PermDelete) > 0 {
+		perm |= PermDelete
+	}
+
+	return perm
+}
+
+// buildCommentThread links the comments visible to the user as replies
+// to their parents and drops the deleted ones that have no replies left
+func buildCommentThread(all []Comment, postPerm int, username string) []*Comment {
+
+	var cs []Comment
+	for _, c := range all {
+		perm := getCommentPermission(postPerm, username, &c)
+		if perm&PermView == 0 {
+			continue
+		}
+		c.CanEdit, c.CanDelete = perm&PermEdit > 0, perm&PermDelete > 0
+		c.Replies = []*Comment{}
+		c.HTML = template.HTML(sanitize.Comment.Sanitize(c.Body))
+		cs = append(cs, c)
+	}
+
+	nodes := make(map[int64]*Comment, len(cs))
+	for i := range cs {
+		nodes[cs[i].Id] = &cs[i]
+	}
+
+	// a reply always has a greater id than its parent,
+	// so the children are settled before their parents
+	var roots []*Comment
+	for i := len(cs) - 1; i >= 0; i-- {
+		c := &cs[i]
+		reverse(c.Replies)
+		if c.Deleted && len(c.Replies) == 0 {
+			continue
+		}
+
+		if parent, ok := nodes[c.ParentId]; ok && c.ParentId != 0 {
+			parent.Replies = append(parent.Replies, c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+	reverse(roots)
+
+	if roots == nil {
+		roots = []*Comment{}
+	}
+
+	return roots
+}
+
+func reverse(cs []*Comment) {
+	for i, j := 0, len(cs)-1; i < j; i, j = i+1, j-1 {
+		cs[i], cs[j] = cs[j], cs[i]
+	}
+}
+
+func getCommentThread(postid int64, postPerm int, username string) ([]*Comment, error) {
+
+	cs, err := getComments(postid)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildCommentThread(cs, postPerm, username), nil
+}
+
+func decodeCommentReq(r *http.Request) (*commentReq, *appError) {
+
+	var req = &commentReq{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return nil, &appError{err, http.StatusBadRequest}
+	}
+
+	return req, nil
+}
+
+// loadCommentPermission loads the comment req.Id and the user's permission on it
+func loadCommentPermission(req *commentReq, info *PageInfo) (*Comment, int, *appError) {
+
+	c, err := getComment(req.Id)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, PermNone, &appError{fmt.Errorf("no comment %d", req.Id),
+			http.StatusBadRequest}
+	case err != nil:
+		return nil, PermNone, &appError{err, http.StatusInternalServerError}
+	}
+
+	info.Id = c.PostId
+	postPerm, err := info.getPermisson()
+	if err != nil {
+		return nil, PermNone, &appError{err, http.StatusBadRequest}
+	}
+
+	return c, getCommentPermission(postPerm, info.Username, c), nil
+}
+
+func commentsjsHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appError {
+
+	req, e := decodeCommentReq(r)
+	if e != nil {
+		return e
+	}
+
+	if req.PostId <= 0 {
+		return &appError{errors.New("invalid post id"), http.StatusBadRequest}
+	}
+
+	info.Id = req.PostId
+	perm, err := info.getPermisson()
+	if err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	// the superadmin lists the comments of an unpublished post to moderate them
+	if perm&(PermView|PermDelete) == 0 {
+		return &appError{errors.New("the user is not allowed to view post"),
+			http.StatusBadRequest}
+	}
+
+	thread, err := getCommentThread(req.PostId, perm, info.Username)
+	if err != nil {
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	fmt.Fprint(w, encodeJson(&commentsResp{jsonResp{true, ""}, thread}))
+
+	return nil
+}
+
+func addcommentjsHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appError {
+
+	req, e := decodeCommentReq(r)
+	if e != nil {
+		return e
+	}
+
+	if req.PostId <= 0 {
+		return &appError{errors.New("invalid post id"), http.StatusBadRequest}
+	}
+
+	info.Id = req.PostId
+	perm, err := info.getPermisson()
+	if err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	if perm&PermView == 0 {
+		return &appError{errors.New("the user is not allowed to comment on post"),
+			http.StatusBadRequest}
+	}
+
+	// a reply shall stay in the thread of the same post
+	if req.ParentId != 0 {
+		parent, err := getComment(req.ParentId)
+		switch {
+		case err == sql.ErrNoRows || (err == nil && parent.PostId != req.PostId):
+			return &appError{fmt.Errorf("no comment %d of post %d", req.ParentId, req.PostId),
+				http.StatusBadRequest}
+		case err != nil:
+			return &appError{err, http.StatusInternalServerError}
+		case parent.Deleted || parent.Status != CommentApproved:
+			return &appError{errors.New("can not reply to a deleted or unapproved comment"),
+				http.StatusBadRequest}
+		}
+	}
+
+	c := &Comment{PostId: req.PostId, ParentId: req.ParentId,
+		Author: info.Username, Body: req.Body}
+	c.Status = screenComment(c)
+	if err := c.save(); err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	fmt.Fprint(w, encodeJson(&commentResp{jsonResp{true, commentSavedMsg(c)}, c.Id}))
+
+	return nil
+}
+
+func editcommentjsHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appError {
+
+	req, e := decodeCommentReq(r)
+	if e != nil {
+		return e
+	}
+
+	c, perm, e := loadCommentPermission(req, info)
+	if e != nil {
+		return e
+	}
+
+	if perm&PermEdit == 0 {
+		return &appError{errors.New("the user is not allowed to edit comment"),
+			http.StatusBadRequest}
+	}
+
+	// an approved comment is screened again, or spam could be edited in
+	c.Body = req.Body
+	if c.Status == CommentApproved {
+		c.Status = screenComment(c)
+	}
+	if err := c.save(); err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	fmt.Fprint(w, encodeJson(&commentResp{jsonResp{true, commentSavedMsg(c)}, c.Id}))
+
+	return nil
+}
+
+func deletecommentjsHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appError {
+
+	req, e := decodeCommentReq(r)
+	if e != nil {
+		return e
+	}
+
+	c, perm, e := loadCommentPermission(req, info)
+	if e != nil {
+		return e
+	}
+
+	if perm&PermDelete == 0 {
+		return &appError{errors.New("the user is not allowed to delete comment"),
+			http.StatusBadRequest}
+	}
+
+	if err := deleteComment(c.Id); err != nil {
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	fmt.Fprint(w, encodeJson(&commentResp{jsonResp{true, "delete success"}, c.Id}))
+
+	return nil
+}
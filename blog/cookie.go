@@ -0,0 +1,160 @@
+package blog
+
+/*
+ * cookies: the session_token cookie carries the token of the session
+ * signed, and encrypted if configured, by securecookie. A cookie that
+ * fails the check is rejected before redis is asked about the token.
+ *
+ * The user cookie only tells the pages who is signed in, it is never
+ * trusted and so it is readable by the scripts.
+ */
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hzget/goblog/blog/securecookie"
+	"github.com/spf13/viper"
+)
+
+const (
+	sessionCookie = "session_token"
+	userCookie    = "user"
+)
+
+/* not thread-safe: assigned once during initialization */
+var cookieCodec *securecookie.Codec
+var cookieSecure, cookieHttpOnly bool
+var cookieSameSite http.SameSite
+
+// sessionClaims is what the session cookie carries
+type sessionClaims struct {
+	Token   string `json:"t"`
+	User    string `json:"u"`
+	Expires int64  `json:"e"`
+}
+
+type cookieKey struct {
+	Id     string
+	Secret string
+}
+
+func initCookies() {
+
+	var keys []cookieKey
+	if err := viper.UnmarshalKey("session.keys", &keys); err != nil {
+		panic(fmt.Errorf("invalid session.keys: %w", err))
+	}
+
+	var sks []securecookie.Key
+	for _, k := range keys {
+		sks = append(sks, securecookie.Key{Id: k.Id, Secret: []byte(k.Secret)})
+	}
+
+	if len(sks) == 0 {
+		secret := make([]byte, securecookie.MinSecretLen)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+		sks = []securecookie.Key{{Id: "random", Secret: secret}}
+		Warn("no session.keys configured, the sessions end when the server restarts")
+	}
+
+	var err error
+	if cookieCodec, err = securecookie.New(sks, viper.GetBool("session.encrypt")); err != nil {
+		panic(err)
+	}
+
+	cookieSecure = viper.GetBool("session.cookie.secure")
+	cookieHttpOnly = !viper.IsSet("session.cookie.httponly") || viper.GetBool("session.cookie.httponly")
+	if cookieSameSite, err = parseSameSite(viper.GetString("session.cookie.samesite")); err != nil {
+		panic(err)
+	}
+}
+
+func parseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(s) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("invalid session.cookie.samesite %q, want lax, strict or none", s)
+}
+
+func newCookie(name, value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   cookieSecure,
+		SameSite: cookieSameSite,
+	}
+}
+
+// setSessionCookies gives the device the cookies of the session
+func setSessionCookies(w http.ResponseWriter, s *Session) error {
+
+	expires := s.Created.Add(sessionTimeout)
+	claims, err := json.Marshal(&sessionClaims{s.Id, s.User, expires.Unix()})
+	if err != nil {
+		return err
+	}
+
+	value, err := cookieCodec.Encode(sessionCookie, claims)
+	if err != nil {
+		return err
+	}
+
+	c := newCookie(sessionCookie, value, expires)
+	c.HttpOnly = cookieHttpOnly
+	http.SetCookie(w, c)
+	http.SetCookie(w, newCookie(userCookie, s.User, expires))
+
+	return nil
+}
+
+// sessionToken verifies the session cookie of the request and returns
+// what it carries. Stale tells that it was signed by a rotated key.
+func sessionToken(r *http.Request) (claims *sessionClaims, stale bool, err error) {
+
+	c, err := r.Cookie(sessionCookie)
+	switch {
+	case err == http.ErrNoCookie:
+		return nil, false, NewRespErr(err, http.StatusUnauthorized)
+	case err != nil:
+		return nil, false, NewRespErr(err, http.StatusInternalServerError)
+	}
+
+	value, stale, err := cookieCodec.Decode(sessionCookie, c.Value)
+	if err != nil {
+		Info(fmt.Sprintf("rejected session cookie from %s: %v", remoteIP(r), err))
+		return nil, false, NewRespErr(ErrSessionCookie, http.StatusUnauthorized)
+	}
+
+	claims = &sessionClaims{}
+	if err := json.Unmarshal(value, claims); err != nil || claims.Token == "" {
+		return nil, false, NewRespErr(ErrSessionCookie, http.StatusUnauthorized)
+	}
+	if time.Now().Unix() > claims.Expires {
+		return nil, false, NewRespErr(ErrSessionCookie, http.StatusUnauthorized)
+	}
+
+	return claims, stale, nil
+}
+
+func clearCookies(w http.ResponseWriter) {
+	expiretime := time.Now().Add(-7 * 24 * time.Hour)
+	for _, name := range []string{sessionCookie, userCookie} {
+		c := newCookie(name, "", expiretime)
+		c.MaxAge = -1
+		http.SetCookie(w, c)
+	}
+}
@@ -0,0 +1,141 @@
+package blog
+
+/*
+ * csrf: a double submit cookie. Every client gets a random token in
+ * the csrf_token cookie, signed by the cookie codec so that it cannot be
+ * planted by another site. A request that may change something, a POST,
+ * PUT, PATCH or DELETE, shall send the same token back in the
+ * X-CSRF-Token header, or in the csrf_token field of a form. Another
+ * site can make the browser send the cookie, but it cannot read it.
+ */
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"html/template"
+	"mime"
+	"net/http"
+	"time"
+)
+
+const (
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+	csrfField  = "csrf_token"
+	csrfLen    = 32
+)
+
+var ErrCsrfToken = NewRespErr(nil, http.StatusForbidden,
+	"invalid CSRF token, please reload the page")
+
+type csrfGuard struct{}
+
+// CsrfGuard is the middleware that rejects the requests changing
+// something without the CSRF token of the client
+func CsrfGuard() http.Handler {
+	return &csrfGuard{}
+}
+
+func (g *csrfGuard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	token := validCsrfCookie(r)
+	if token == "" {
+		var err error
+		if token, err = newCsrfToken(); err != nil {
+			RespondError(w, err)
+			return
+		}
+		c := newCookie(csrfCookie, token, time.Now().Add(sessionTimeout))
+		http.SetCookie(w, c)
+		// the handlers embed the token of the request in their pages
+		replaceCookie(r, c)
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return
+	}
+
+	sent := r.Header.Get(csrfHeader)
+	if sent == "" && isFormPost(r) {
+		sent = r.PostFormValue(csrfField)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+		Info("rejected " + r.Method + " " + r.URL.Path + " from " + remoteIP(r) +
+			": invalid CSRF token")
+		RespondError(w, ErrCsrfToken)
+	}
+}
+
+// validCsrfCookie returns the csrf cookie of the request if it was made here
+func validCsrfCookie(r *http.Request) string {
+	c, err := r.Cookie(csrfCookie)
+	if err != nil {
+		return ""
+	}
+	if _, _, err := cookieCodec.Decode(csrfCookie, c.Value); err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+func newCsrfToken() (string, error) {
+	b := make([]byte, csrfLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return cookieCodec.Encode(csrfCookie, b)
+}
+
+// replaceCookie makes c the cookie of its name in the request
+func replaceCookie(r *http.Request, c *http.Cookie) {
+	cs := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, old := range cs {
+		if old.Name != c.Name {
+			r.AddCookie(old)
+		}
+	}
+	r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+}
+
+// isFormPost tells whether the body is an html form, a json body is
+// never read here
+func isFormPost(r *http.Request) bool {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return ct == "application/x-www-form-urlencoded"
+}
+
+// csrfToken returns the token the pages of the request shall send back
+func csrfToken(r *http.Request) string {
+	c, err := r.Cookie(csrfCookie)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// csrfInput is the template helper embedding the token in a form
+func csrfInput(token string) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + csrfField + `" value="` +
+		template.HTMLEscapeString(token) + `">`)
+}
+
+// methods allows the handler to be called with the methods only, the
+// ones changing something are never reached by a link or a redirect
+func methods(h http.HandlerFunc, ms ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range ms {
+			if r.Method == m {
+				h(w, r)
+				return
+			}
+		}
+		for _, m := range ms {
+			w.Header().Add("Allow", m)
+		}
+		http.Error(w, encodeJsonResp(false, "method "+r.Method+" not allowed"),
+			http.StatusMethodNotAllowed)
+	}
+}
@@ -7,8 +7,9 @@ import (
 
 var ErrHttpUnAuthorized = errors.New("StatusUnauthorized")
 
-var ErrCacheTokenUnmatch = errors.New("Cache token unmatch")
+var ErrSessionCookie = errors.New("invalid session cookie")
 var ErrCredentialFailed = errors.New("fail to validate credential")
+var ErrVersionConflict = errors.New("the post was changed by someone else")
 
 type limitErr struct {
 	err error
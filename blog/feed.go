@@ -0,0 +1,490 @@
+package blog
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// the formats of the feeds
+const (
+	FeedRSS  = "rss"
+	FeedAtom = "atom"
+	FeedJSON = "json"
+)
+
+const (
+	defaultFeedTitle = "Go Blog"
+	defaultFeedLimit = 20
+	// feed readers poll often, a shared cache may answer them a while
+	feedMaxAge = 300
+)
+
+/* set up by the config */
+var siteURL string
+var feedTitle = defaultFeedTitle
+var feedLimit = defaultFeedLimit
+
+var feedTypes = map[string]string{
+	FeedRSS:  "application/rss+xml; charset=utf-8",
+	FeedAtom: "application/atom+xml; charset=utf-8",
+	FeedJSON: "application/feed+json; charset=utf-8",
+}
+
+// feed is the newest published posts of the site or of an author,
+// every url in it is absolute
+type feed struct {
+	Title   string
+	Author  string
+	HomeURL string
+	SelfURL string
+	Updated time.Time
+	Items   []feedItem
+}
+
+type feedItem struct {
+	Title     string
+	Author    string
+	URL       string
+	HTML      string
+	Published time.Time
+	Updated   time.Time
+}
+
+// siteBase returns the absolute url of the site root, the configured
+// page.url followed by the site prefix. It is empty without page.url:
+// the Host header of a request is chosen by the client, so the feeds
+// and the sitemaps are not served then.
+func siteBase() string {
+	if siteURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(siteURL, "/") + sitePrefix
+}
+
+// noSiteBase answers a request that needs absolute urls without page.url
+func noSiteBase(w http.ResponseWriter) {
+	http.Error(w, "page.url is not set", http.StatusNotFound)
+}
+
+func feedURL(base, format, author string) string {
+	u := base + "/feed." + format
+	if author != "" {
+		u += "?author=" + url.QueryEscape(author)
+	}
+	return u
+}
+
+// feedPosts returns the newest published posts of the author, or of
+// everyone if author is empty
+func feedPosts(author string) ([]PostSummary, error) {
+	// no viewer: the published posts only, newest out first
+	return getPostSummaries(&PostListQuery{Author: author, Sort: SortPublished, Limit: feedLimit})
+}
+
+// feedETag identifies a feed by its posts and their versions,
+// so that a conditional request is answered before the bodies are loaded
+func feedETag(format, base, author string, ps []PostSummary) string {
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n", format, base, author, feedTitle)
+	for _, p := range ps {
+		fmt.Fprintf(h, "%d %d %d\n", p.Id, p.Modified.UnixNano(), p.PublishAt.UnixNano())
+	}
+
+	return fmt.Sprintf(`"%x"`, h.Sum(nil)[:16])
+}
+
+// published is the time the post is out: its publish time if it was
+// scheduled, else its creation
+func published(p *PostSummary) time.Time {
+	if p.PublishAt.After(p.Date) {
+		return p.PublishAt
+	}
+	return p.Date
+}
+
+// feedUpdated is the latest time any of the posts changed or came out
+func feedUpdated(ps []PostSummary) time.Time {
+
+	var t time.Time
+	for i := range ps {
+		for _, u := range []time.Time{ps[i].Modified, published(&ps[i])} {
+			if u.After(t) {
+				t = u
+			}
+		}
+	}
+
+	return t
+}
+
+func loadFeed(base, format, author string, ps []PostSummary) (*feed, error) {
+
+	f := &feed{
+		Title:   feedTitle,
+		Author:  author,
+		HomeURL: base + "/",
+		SelfURL: feedURL(base, format, author),
+		Updated: feedUpdated(ps),
+	}
+	if author != "" {
+		f.Title += " - " + author
+		f.HomeURL = base + "/postlist?author=" + url.QueryEscape(author)
+	}
+
+	for i := range ps {
+		p, err := loadPost(ps[i].Id)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := renderBody(p.Format, p.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		u := base + "/view/" + strconv.FormatInt(p.Id, 10)
+		f.Items = append(f.Items, feedItem{
+			Title:     p.Title,
+			Author:    p.Author,
+			URL:       u,
+			HTML:      absoluteLinks(body, u),
+			Published: published(&ps[i]),
+			Updated:   ps[i].Modified,
+		})
+	}
+
+	return f, nil
+}
+
+// absoluteLinks resolves the links and images of a post body against
+// the url of the post, since a feed reader shows the body elsewhere
+func absoluteLinks(s, base string) string {
+
+	b, err := url.Parse(base)
+	if err != nil {
+		return s
+	}
+
+	var out strings.Builder
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return out.String()
+		}
+
+		t := z.Token()
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			out.WriteString(t.String())
+			continue
+		}
+
+		for i, a := range t.Attr {
+			if a.Key != "href" && a.Key != "src" {
+				continue
+			}
+			if u, err := b.Parse(strings.TrimSpace(a.Val)); err == nil {
+				t.Attr[i].Val = u.String()
+			}
+		}
+		out.WriteString(t.String())
+	}
+}
+
+// notModified tells whether the client has the feed of etag and
+// modtime already. If-None-Match wins over If-Modified-Since.
+func notModified(r *http.Request, etag string, modtime time.Time) bool {
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, t := range strings.Split(inm, ",") {
+			t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+			if t == etag || t == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if modtime.IsZero() {
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	return !modtime.Truncate(time.Second).After(ims)
+}
+
+// feedHandler serves the feed of a format, /feed.rss, /feed.atom or
+// /feed.json, and the feed of an author, /feed.#format?author=#name
+func feedHandler(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		base := siteBase()
+		if base == "" {
+			noSiteBase(w)
+			return
+		}
+
+		author := r.FormValue("author")
+		ps, err := feedPosts(author)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		etag := feedETag(format, base, author, ps)
+		updated := feedUpdated(ps)
+
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", feedMaxAge))
+		w.Header().Set("ETag", etag)
+		if !updated.IsZero() {
+			w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+		}
+		if notModified(r, etag, updated) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		f, err := loadFeed(base, format, author, ps)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		b, err := f.encode(format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", feedTypes[format])
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		if r.Method != http.MethodHead {
+			w.Write(b)
+		}
+	}
+}
+
+func (f *feed) encode(format string) ([]byte, error) {
+
+	var v interface{}
+	switch format {
+	case FeedRSS:
+		v = f.rss()
+	case FeedAtom:
+		v = f.atom()
+	case FeedJSON:
+		return json.MarshalIndent(f.jsonFeed(), "", "\t")
+	default:
+		return nil, fmt.Errorf("unknown feed format %q", format)
+	}
+
+	b, err := xml.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), b...), nil
+}
+
+/* RSS 2.0 */
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          rssLink   `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Creator     string  `xml:"dc:creator"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func (f *feed) rss() *rssFeed {
+
+	c := rssChannel{
+		Title:       f.Title,
+		Link:        f.HomeURL,
+		Description: "The newest posts of " + f.Title,
+		Self:        rssLink{f.SelfURL, "self", feedTypes[FeedRSS]},
+	}
+	if !f.Updated.IsZero() {
+		c.LastBuildDate = f.Updated.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, it := range f.Items {
+		c.Items = append(c.Items, rssItem{
+			Title:       it.Title,
+			Link:        it.URL,
+			GUID:        rssGUID{true, it.URL},
+			PubDate:     it.Published.UTC().Format(time.RFC1123Z),
+			Creator:     it.Author,
+			Description: it.HTML,
+		})
+	}
+
+	return &rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: c,
+	}
+}
+
+/* Atom */
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  *atomPerson `xml:"author,omitempty"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	Id        string      `xml:"id"`
+	Link      atomLink    `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    atomPerson  `xml:"author"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (f *feed) atom() *atomFeed {
+
+	a := &atomFeed{
+		Title:   f.Title,
+		Id:      f.SelfURL,
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{f.SelfURL, "self", feedTypes[FeedAtom]},
+			{f.HomeURL, "alternate", "text/html"},
+		},
+	}
+	if f.Author != "" {
+		a.Author = &atomPerson{f.Author}
+	}
+
+	for _, it := range f.Items {
+		a.Entries = append(a.Entries, atomEntry{
+			Title:     it.Title,
+			Id:        it.URL,
+			Link:      atomLink{it.URL, "alternate", "text/html"},
+			Published: it.Published.UTC().Format(time.RFC3339),
+			Updated:   it.Updated.UTC().Format(time.RFC3339),
+			Author:    atomPerson{it.Author},
+			Content:   atomContent{"html", it.HTML},
+		})
+	}
+
+	return a
+}
+
+/* JSON Feed 1.1 */
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	Id            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Authors       []jsonFeedAuthor `json:"authors"`
+}
+
+func (f *feed) jsonFeed() *jsonFeed {
+
+	j := &jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.HomeURL,
+		FeedURL:     f.SelfURL,
+		Items:       []jsonFeedItem{},
+	}
+	if f.Author != "" {
+		j.Authors = []jsonFeedAuthor{{f.Author}}
+	}
+
+	for _, it := range f.Items {
+		j.Items = append(j.Items, jsonFeedItem{
+			Id:            it.URL,
+			URL:           it.URL,
+			Title:         it.Title,
+			ContentHTML:   it.HTML,
+			DatePublished: it.Published.UTC().Format(time.RFC3339),
+			DateModified:  it.Updated.UTC().Format(time.RFC3339),
+			Authors:       []jsonFeedAuthor{{it.Author}},
+		})
+	}
+
+	return j
+}
@@ -0,0 +1,198 @@
+// Package frontmatter reads the markdown posts of static site generators
+// like Hugo and Jekyll: a YAML front matter between "---" lines or a TOML
+// one between "+++" lines, followed by the markdown body.
+package frontmatter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrNoFrontMatter is returned for a file that does not start with
+// a front matter
+var ErrNoFrontMatter = errors.New("frontmatter: no front matter")
+
+// Document is a post read from a file. The fields missing in the front
+// matter are zero, but for Date which Jekyll keeps in the file name.
+type Document struct {
+	Title    string
+	Date     time.Time
+	Modified time.Time
+	Author   string
+	Tags     []string
+	Draft    bool
+	Body     string
+}
+
+// the layouts of the dates in the front matters seen in the wild,
+// the ones without a zone are local times
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// the date of a Jekyll post is the start of its file name
+var jekyllName = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-`)
+
+// Parse reads the file of the name, which gives the date of a Jekyll post
+func Parse(name string, data []byte) (*Document, error) {
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	var delim string
+	switch {
+	case bytes.HasPrefix(data, []byte("---\n")):
+		delim = "---"
+	case bytes.HasPrefix(data, []byte("+++\n")):
+		delim = "+++"
+	default:
+		return nil, ErrNoFrontMatter
+	}
+
+	front, body, err := split(data[len(delim)+1:], delim)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	if delim == "---" {
+		err = yaml.Unmarshal(front, &fields)
+	} else {
+		_, err = toml.Decode(string(front), &fields)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("frontmatter: %w", err)
+	}
+
+	doc := &Document{Body: strings.TrimLeft(string(body), "\n")}
+	if err := doc.set(fields); err != nil {
+		return nil, err
+	}
+
+	if doc.Date.IsZero() {
+		if m := jekyllName.FindStringSubmatch(filepath.Base(name)); m != nil {
+			doc.Date, _ = time.ParseInLocation("2006-01-02", m[1], time.Local)
+		}
+	}
+
+	return doc, nil
+}
+
+// split returns the front matter up to the line of the delimiter
+// and the body after it
+func split(data []byte, delim string) ([]byte, []byte, error) {
+
+	for i := 0; ; {
+		j := bytes.IndexByte(data[i:], '\n')
+		line := data[i:]
+		if j >= 0 {
+			line = data[i : i+j]
+		}
+
+		if string(line) == delim {
+			return data[:i], data[i+len(line):], nil
+		}
+		if j < 0 {
+			return nil, nil, fmt.Errorf("frontmatter: no closing %q", delim)
+		}
+		i += j + 1
+	}
+}
+
+func (doc *Document) set(fields map[string]interface{}) error {
+
+	var err error
+	doc.Title = str(fields["title"])
+
+	if doc.Date, err = date(fields["date"]); err != nil {
+		return err
+	}
+	// hugo, jekyll-last-modified-at and others
+	for _, k := range []string{"lastmod", "last_modified_at", "modified", "updated"} {
+		if v, ok := fields[k]; ok {
+			if doc.Modified, err = date(v); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	// hugo has a list of authors, the first one is taken
+	doc.Author = str(fields["author"])
+	if as := list(fields["authors"]); doc.Author == "" && len(as) > 0 {
+		doc.Author = as[0]
+	}
+
+	doc.Tags = list(fields["tags"])
+
+	draft, _ := fields["draft"].(bool)
+	published, ok := fields["published"].(bool) // jekyll
+	doc.Draft = draft || ok && !published
+
+	return nil
+}
+
+func str(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprint(v))
+}
+
+// list reads a list of strings, or a string of words as Jekyll allows
+func list(v interface{}) []string {
+	switch v := v.(type) {
+	case []interface{}:
+		var l []string
+		for _, e := range v {
+			if s := str(e); s != "" {
+				l = append(l, s)
+			}
+		}
+		return l
+	case []string:
+		return v
+	case string:
+		return strings.Fields(v)
+	}
+	return nil
+}
+
+func date(v interface{}) (time.Time, error) {
+
+	switch v := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		// the local dates and times of toml have a zone of their own
+		if strings.HasSuffix(v.Location().String(), "-local") {
+			return time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(),
+				v.Second(), v.Nanosecond(), time.Local), nil
+		}
+		return v, nil
+	}
+
+	// the dates of yaml are strings
+	s := str(v)
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("frontmatter: invalid date %q", s)
+}
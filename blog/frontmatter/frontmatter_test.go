@@ -0,0 +1,81 @@
+package frontmatter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseYAML(t *testing.T) {
+	src := "---\r\ntitle: \"Hello: world\"\r\ndate: 2019-03-04 10:20:30 +0800\r\n" +
+		"last_modified_at: 2020-01-02\r\nauthor: bob\r\ntags: [go, web]\r\n---\r\n\r\n# Hi\r\n"
+
+	doc, err := Parse("posts/hello.md", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Title != "Hello: world" || doc.Author != "bob" || doc.Body != "# Hi\n" {
+		t.Fatalf("want the title, the author and the body, got %+v", doc)
+	}
+	if !reflect.DeepEqual(doc.Tags, []string{"go", "web"}) {
+		t.Fatalf("want the tags, got %v", doc.Tags)
+	}
+
+	want := time.Date(2019, 3, 4, 2, 20, 30, 0, time.UTC)
+	if !doc.Date.Equal(want) {
+		t.Fatalf("want the date %v, got %v", want, doc.Date)
+	}
+	if !doc.Modified.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("want the local mtime, got %v", doc.Modified)
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	src := "+++\ntitle = \"Hugo\"\ndate = 2021-05-06T07:08:09Z\nlastmod = 2021-05-07\n" +
+		"authors = [\"amy\", \"bob\"]\ntags = [\"a\"]\ndraft = true\n+++\nbody\n"
+
+	doc, err := Parse("content/post/hugo.md", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Title != "Hugo" || doc.Author != "amy" || !doc.Draft || doc.Body != "body\n" {
+		t.Fatalf("want the fields of the front matter, got %+v", doc)
+	}
+	if !doc.Date.Equal(time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)) {
+		t.Fatalf("want the date, got %v", doc.Date)
+	}
+	if !doc.Modified.Equal(time.Date(2021, 5, 7, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("want the local date of lastmod, got %v", doc.Modified)
+	}
+}
+
+func TestParseJekyll(t *testing.T) {
+	src := "---\ntitle: Old\ntags: one two\npublished: false\n---\ntext"
+
+	doc, err := Parse("_posts/2015-07-08-old.markdown", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !doc.Date.Equal(time.Date(2015, 7, 8, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("want the date of the file name, got %v", doc.Date)
+	}
+	if !reflect.DeepEqual(doc.Tags, []string{"one", "two"}) || !doc.Draft {
+		t.Fatalf("want the tags of the words and a draft, got %+v", doc)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for name, src := range map[string]string{
+		"no front matter": "# title\n",
+		"not closed":      "---\ntitle: x\n",
+		"invalid yaml":    "---\ntitle: [x\n---\n",
+		"invalid date":    "---\ndate: yesterday\n---\n",
+	} {
+		if _, err := Parse("x.md", []byte(src)); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
@@ -22,17 +22,37 @@ func NewHandler() Handler {
 	}
 }
 
+// a middleware that writes a response, an error most likely, ends
+// the request
 func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
+	tw := &trackedWriter{ResponseWriter: w}
 	for _, h := range r.handlers {
-		h.ServeHTTP(w, req)
-		// TODO:
-		//  [1] what if there's some error?
+		h.ServeHTTP(tw, req)
+		if tw.written {
+			return
+		}
 	}
 
 	r.mux.ServeHTTP(w, req)
 }
 
+// trackedWriter tells whether a response was written
+type trackedWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *trackedWriter) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *trackedWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
 // add a middleware
 // not thread-safe
 func (r *router) Use(handler http.Handler) Handler {
@@ -2,7 +2,9 @@ package blog
 
 import (
 	"bytes"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 )
@@ -26,3 +28,65 @@ func TestHttpLogger(t *testing.T) {
 		t.Fatalf("want: %v, but got: %v", want, got)
 	}
 }
+
+func TestCsrfGuard(t *testing.T) {
+	needGlobals(t)
+
+	// the client gets a token with its first page
+	req := httptest.NewRequest("GET", "/nosuchpage", nil)
+	w := httptest.NewRecorder()
+	NewHandler().Use(CsrfGuard()).ServeHTTP(w, req)
+
+	var token string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == csrfCookie {
+			token = c.Value
+		}
+	}
+	if token == "" || w.Code == http.StatusForbidden {
+		t.Fatalf("want a csrf cookie and the page, got %v, %d", w.Result().Cookies(), w.Code)
+	}
+
+	cases := []struct {
+		name, cookie, header, form string
+		code                       int
+	}{
+		{"NoToken", csrfCookie + "=" + token, "", "", http.StatusForbidden},
+		{"NoCookie", "", token, "", http.StatusForbidden},
+		{"Unmatched", csrfCookie + "=" + token, token + "x", "", http.StatusForbidden},
+		{"Unsigned", csrfCookie + "=abc", "abc", "", http.StatusForbidden},
+		{"Header", csrfCookie + "=" + token, token, "", http.StatusNotFound},
+		{"Form", csrfCookie + "=" + token, "", csrfField + "=" + url.QueryEscape(token), http.StatusNotFound},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/nosuchpage", strings.NewReader(tc.form))
+			req.Header.Set("Cookie", tc.cookie)
+			if tc.header != "" {
+				req.Header.Set(csrfHeader, tc.header)
+			}
+			if tc.form != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+
+			w := httptest.NewRecorder()
+			NewHandler().Use(CsrfGuard()).ServeHTTP(w, req)
+			if w.Code != tc.code {
+				t.Fatalf("want http code %d, got %d: %s", tc.code, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestMethods(t *testing.T) {
+	h := methods(func(w http.ResponseWriter, r *http.Request) {}, "POST", "DELETE")
+	for method, code := range map[string]int{"GET": http.StatusMethodNotAllowed,
+		"POST": http.StatusOK, "DELETE": http.StatusOK} {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(method, "/delete/1", nil))
+		if w.Code != code {
+			t.Errorf("%s: want http code %d, got %d", method, code, w.Code)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Package imaging cleans uploaded images and makes their resized variants
+// with the pure Go codecs of png, jpeg and gif.
+//
+// Cleaning removes the metadata a camera or an editor leaves in a file,
+// like the EXIF of a photo with its location. The pixels of png and jpeg
+// are kept as they are, a gif is decoded and encoded again frame by frame,
+// which is lossless.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+)
+
+// ErrFormat is returned for an image that is not png, jpeg or gif
+var ErrFormat = errors.New("imaging: unsupported format")
+
+// MaxPixels bounds the images decoded, a small file may claim to be
+// a huge image and take all the memory once decoded
+const MaxPixels = 40 << 20
+
+// MaxFrames bounds the frames of a gif, every frame is decoded to
+// the size of the gif, so its pixels count once per frame against
+// MaxPixels as well
+const MaxFrames = 1000
+
+// jpegQuality is the quality of the jpegs encoded
+const jpegQuality = 85
+
+// Variant is a resized copy of an image, no wider than Width
+type Variant struct {
+	Name  string
+	Width int
+}
+
+// Variants are made for the images wider than them, smallest first
+var Variants = []Variant{
+	{"thumb", 160},
+	{"medium", 640},
+	{"large", 1280},
+}
+
+// VariantFormat returns the format of the variants of an image, a gif
+// gets static png variants made from its first frame
+func VariantFormat(format string) string {
+	if format == "gif" {
+		return "png"
+	}
+	return format
+}
+
+// Image is an encoded image and its size
+type Image struct {
+	Data   []byte
+	Format string // "png", "jpeg" or "gif"
+	Width  int
+	Height int
+}
+
+// Resized is an encoded variant of an image
+type Resized struct {
+	Name string
+	Image
+}
+
+// Clean removes the metadata of the encoded image. A jpeg that is not
+// upright by its EXIF orientation is turned upright and encoded again,
+// since its orientation is gone with the metadata.
+func Clean(data []byte) (*Image, error) {
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, fmt.Errorf("imaging: %dx%d is too large", cfg.Width, cfg.Height)
+	}
+
+	img := &Image{Format: format, Width: cfg.Width, Height: cfg.Height}
+	switch format {
+	case "png":
+		img.Data, err = stripPNG(data)
+	case "jpeg":
+		if o := jpegOrientation(data); o > 1 && o <= 8 {
+			return uprightJPEG(data, o)
+		}
+		img.Data, err = stripJPEG(data)
+	case "gif":
+		img.Data, err = cleanGIF(data)
+	default:
+		return nil, ErrFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+func uprightJPEG(data []byte, orientation int) (*Image, error) {
+
+	src, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	dst := orient(src, orientation)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+
+	b := dst.Bounds()
+	return &Image{buf.Bytes(), "jpeg", b.Dx(), b.Dy()}, nil
+}
+
+func cleanGIF(data []byte) ([]byte, error) {
+
+	cfg, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	n, err := gifFrames(data)
+	if err != nil {
+		return nil, err
+	}
+	if n > MaxFrames || n*cfg.Width*cfg.Height > MaxPixels {
+		return nil, fmt.Errorf("imaging: %d frames of %dx%d are too many", n, cfg.Width, cfg.Height)
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// gifFrames counts the frames of a gif by walking its blocks, without
+// decoding them
+func gifFrames(data []byte) (int, error) {
+
+	errBad := errors.New("imaging: malformed gif")
+
+	// the header, the logical screen and the global color table
+	if len(data) < 13 {
+		return 0, errBad
+	}
+	i := 13
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&7 + 1)
+	}
+
+	// skipBlocks skips the data sub-blocks from i to their terminator
+	skipBlocks := func(i int) int {
+		for i < len(data) && data[i] != 0 {
+			i += int(data[i]) + 1
+		}
+		return i + 1
+	}
+
+	n := 0
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // an extension: its label and its sub-blocks
+			i = skipBlocks(i + 2)
+		case 0x2c: // an image: its descriptor, color table, lzw code size and sub-blocks
+			if i+10 > len(data) {
+				return 0, errBad
+			}
+			n++
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&7 + 1)
+			}
+			i = skipBlocks(i + 1)
+		case 0x3b: // the trailer
+			return n, nil
+		default:
+			return 0, errBad
+		}
+	}
+
+	// a gif cut short is decoded as far as it goes
+	return n, nil
+}
+
+// Resize makes the variants narrower than the image, smallest first
+func (img *Image) Resize() ([]Resized, error) {
+
+	var src image.Image
+	var rs []Resized
+	for _, v := range Variants {
+		if img.Width <= v.Width {
+			break
+		}
+
+		if src == nil {
+			var err error
+			if src, _, err = image.Decode(bytes.NewReader(img.Data)); err != nil {
+				return nil, err
+			}
+		}
+
+		r, err := resize(src, v, VariantFormat(img.Format))
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+
+	return rs, nil
+}
+
+func resize(src image.Image, v Variant, format string) (Resized, error) {
+
+	b := src.Bounds()
+	h := (b.Dy()*v.Width + b.Dx()/2) / b.Dx()
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, v.Width, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return Resized{}, err
+	}
+
+	return Resized{v.Name, Image{buf.Bytes(), format, v.Width, h}}, nil
+}
+
+// orient turns the image upright by its EXIF orientation 1-8
+func orient(src image.Image, o int) image.Image {
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch o {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // turned left, rotate it clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // turned right, rotate it counterclockwise
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			dst.Set(x, y, src.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
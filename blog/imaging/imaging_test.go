@@ -0,0 +1,255 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	return img
+}
+
+// exifSegment is an APP1 segment of a big endian tiff with an
+// orientation and a gps tag
+func exifSegment(orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2a\x00\x00\x00\x08")
+	binary.Write(&tiff, binary.BigEndian, uint16(2))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0112, 3, 0, 1, orientation, 0})
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x8825, 4, 0, 1, 0, 0})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	seg := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+func testJPEG(t *testing.T, w, h int, orientation uint16) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(w, h), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	return append(append([]byte{0xff, 0xd8}, exifSegment(orientation)...), data[2:]...)
+}
+
+func TestCleanJPEG(t *testing.T) {
+	data := testJPEG(t, 40, 20, 1)
+	if o := jpegOrientation(data); o != 1 {
+		t.Fatalf("want orientation 1, got %d", o)
+	}
+
+	img, err := Clean(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(img.Data, []byte("Exif")) {
+		t.Fatal("want the EXIF removed")
+	}
+	if len(img.Data) != len(data)-len(exifSegment(1)) {
+		t.Fatalf("want only the EXIF segment removed, got %d bytes of %d", len(img.Data), len(data))
+	}
+	if img.Format != "jpeg" || img.Width != 40 || img.Height != 20 {
+		t.Fatalf("want a 40x20 jpeg, got %s %dx%d", img.Format, img.Width, img.Height)
+	}
+}
+
+func TestCleanJPEGOrientation(t *testing.T) {
+	img, err := Clean(testJPEG(t, 40, 20, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(img.Data, []byte("Exif")) {
+		t.Fatal("want the EXIF removed")
+	}
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 20 || cfg.Height != 40 || img.Width != 20 || img.Height != 40 {
+		t.Fatalf("want the image turned to 20x40, got %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 3, 2))
+	src.Pix = []uint8{1, 2, 3, 4, 5, 6}
+
+	cases := map[int][]uint8{
+		1: {1, 2, 3, 4, 5, 6},
+		2: {3, 2, 1, 6, 5, 4},
+		3: {6, 5, 4, 3, 2, 1},
+		4: {4, 5, 6, 1, 2, 3},
+		5: {1, 4, 2, 5, 3, 6},
+		6: {4, 1, 5, 2, 6, 3},
+		7: {6, 3, 5, 2, 4, 1},
+		8: {3, 6, 2, 5, 1, 4},
+	}
+
+	for o, want := range cases {
+		dst := orient(src, o)
+		b := dst.Bounds()
+		var got []uint8
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				got = append(got, color.GrayModel.Convert(dst.At(x, y)).(color.Gray).Y)
+			}
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("orientation %d: want %v, got %v", o, want, got)
+		}
+	}
+}
+
+func pngChunk(typ, data string) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], typ)
+	chunk = append(chunk, data...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	return append(chunk, crc...)
+}
+
+func TestCleanPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(30, 10)); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+
+	// a text chunk right after the header chunk
+	const ihdr = 8 + 25
+	data := append(append(append([]byte{}, plain[:ihdr]...),
+		pngChunk("tEXt", "Author\x00someone")...), plain[ihdr:]...)
+
+	img, err := Clean(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(img.Data, plain) {
+		t.Fatal("want the text chunk removed and the rest kept")
+	}
+	if _, err := png.Decode(bytes.NewReader(img.Data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCleanGIF(t *testing.T) {
+	pal := color.Palette{color.Black, color.White}
+	g := &gif.GIF{LoopCount: 0}
+	for i := 0; i < 2; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 8, 8), pal))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := Clean(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := gif.DecodeAll(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Image) != 2 {
+		t.Fatalf("want the 2 frames kept, got %d", len(out.Image))
+	}
+}
+
+func TestCleanGIFFrames(t *testing.T) {
+	pal := color.Palette{color.Black, color.White}
+	g := &gif.GIF{}
+	for i := 0; i < MaxFrames+1; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 1, 1), pal))
+		g.Delay = append(g.Delay, 0)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := gifFrames(buf.Bytes()); err != nil || n != MaxFrames+1 {
+		t.Fatalf("want %d frames, got %d %v", MaxFrames+1, n, err)
+	}
+	if _, err := Clean(buf.Bytes()); err == nil {
+		t.Fatal("want an error for too many frames")
+	}
+
+	// the frames are small, but each is decoded to the size of the screen
+	g.Image, g.Delay = g.Image[:2], g.Delay[:2]
+	g.Config = image.Config{ColorModel: pal, Width: 6000, Height: 6000}
+	buf.Reset()
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Clean(buf.Bytes()); err == nil {
+		t.Fatal("want an error for too many pixels in all the frames")
+	}
+}
+
+func TestResize(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(1000, 500)); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := Clean(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := img.Resize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// large is not narrower than the image
+	if len(rs) != 2 {
+		t.Fatalf("want 2 variants, got %d", len(rs))
+	}
+	for i, want := range []struct{ w, h int }{{160, 80}, {640, 320}} {
+		cfg, err := png.DecodeConfig(bytes.NewReader(rs[i].Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Width != want.w || cfg.Height != want.h || rs[i].Width != want.w || rs[i].Height != want.h {
+			t.Errorf("%s: want %dx%d, got %dx%d", rs[i].Name, want.w, want.h, cfg.Width, cfg.Height)
+		}
+	}
+}
+
+func TestCleanErrors(t *testing.T) {
+	if _, err := Clean([]byte("not an image")); err == nil {
+		t.Fatal("want an error for a text")
+	}
+
+	// a png header claiming a huge image
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 100000)
+	binary.BigEndian.PutUint32(data[20:], 100000)
+	if _, err := Clean(data); err == nil {
+		t.Fatal("want an error for a huge image")
+	}
+}
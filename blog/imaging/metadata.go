@@ -0,0 +1,141 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errCorrupt = errors.New("imaging: corrupt image")
+
+// the jpeg segments of metadata: APP1 (EXIF, XMP), APP13 (IPTC) and comments.
+// APP0 (JFIF), APP2 (ICC profile) and APP14 (Adobe) tell how to read the
+// colors and are kept.
+var jpegMetadata = map[byte]bool{0xe1: true, 0xed: true, 0xfe: true}
+
+// jpegSegments calls fn with the marker and the whole of each segment up
+// to the start of scan, and returns the offset of the start of scan
+func jpegSegments(data []byte, fn func(marker byte, seg []byte)) (int, error) {
+
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return 0, errCorrupt
+	}
+
+	i := 2
+	for {
+		if i+4 > len(data) || data[i] != 0xff {
+			return 0, errCorrupt
+		}
+		marker := data[i+1]
+		if marker == 0xff { // fill byte
+			i++
+			continue
+		}
+		if marker == 0xda { // start of scan, the entropy coded data follows
+			return i, nil
+		}
+
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			return 0, errCorrupt
+		}
+		fn(marker, data[i:i+2+n])
+		i += 2 + n
+	}
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+
+	out := []byte{0xff, 0xd8}
+	sos, err := jpegSegments(data, func(marker byte, seg []byte) {
+		if !jpegMetadata[marker] {
+			out = append(out, seg...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, data[sos:]...), nil
+}
+
+// jpegOrientation returns the EXIF orientation of a jpeg, 0 if it has none
+func jpegOrientation(data []byte) int {
+
+	o := 0
+	jpegSegments(data, func(marker byte, seg []byte) {
+		if marker == 0xe1 && o == 0 && bytes.HasPrefix(seg[4:], []byte("Exif\x00\x00")) {
+			o = exifOrientation(seg[10:])
+		}
+	})
+
+	return o
+}
+
+// exifOrientation reads the orientation tag of the first IFD of the tiff
+func exifOrientation(tiff []byte) int {
+
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+
+	n := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < n; i++ {
+		e := ifd + 2 + i*12
+		if e+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[e:]) == 0x0112 {
+			return int(order.Uint16(tiff[e+8:]))
+		}
+	}
+
+	return 0
+}
+
+// the png chunks of metadata: text, EXIF and the time of the last change
+var pngMetadata = map[string]bool{
+	"tEXt": true, "zTXt": true, "iTXt": true, "eXIf": true, "tIME": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+
+	const sig = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(sig)) {
+		return nil, errCorrupt
+	}
+
+	out := []byte(sig)
+	for i := len(sig); i < len(data); {
+		if i+8 > len(data) {
+			return nil, errCorrupt
+		}
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + n // length, type, data and crc
+		if n < 0 || end > len(data) || end < i {
+			return nil, errCorrupt
+		}
+
+		if !pngMetadata[string(data[i+4:i+8])] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+
+	return out, nil
+}
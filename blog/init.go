@@ -4,14 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"html/template"
 	"log"
 	"regexp"
-	"text/template"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
+	"github.com/hzget/goblog/blog/render"
 	"github.com/spf13/viper"
 )
 
@@ -22,7 +24,7 @@ var templates *template.Template
 const shortDuration = 3 * time.Second
 const dbStartupTime = 1 * time.Minute
 const uuidRe = `[0-9a-fA-F]{8}\-[0-9a-fA-F]{4}\-[0-9a-fA-F]{4}\-[0-9a-fA-F]{4}\-[0-9a-fA-F]{12}`
-const postRe = `/(view|edit|save|delete)/([0-9]+)`
+const postRe = `/(view|edit|save|delete|history|diff)/([0-9]+)`
 
 /* not thread-safe */
 var debugPage bool
@@ -34,6 +36,8 @@ var siteRe string
 var dataAnalysisAddress string
 var templpath = "./"
 var dbcache = false
+var sqlitePath string
+var searchIndexFile string
 
 var logfilename string
 var loglevel string
@@ -44,8 +48,17 @@ func initGlobals() {
 	initDebugMode()
 	initPagePrefix()
 	initRedisClient()
+	initCookies()
+	initLogin()
 	initDBHandler()
-	initDBTables()
+	initSchema()
+	initStores()
+	initModeration()
+	initSearch()
+	initRender()
+	initMedia()
+	initFeed()
+	initRobots()
 	initDataAnalysis()
 	initCache()
 	initTemplate()
@@ -72,6 +85,61 @@ func initCache() {
 	dbcache = viper.GetBool("cache.mysql")
 }
 
+func initModeration() {
+	moderateAll = viper.GetBool("comment.moderate")
+	if spamThreshold = viper.GetFloat64("comment.spamthreshold"); spamThreshold <= 0 {
+		spamThreshold = defaultSpamThreshold
+	}
+	initSpamClassifier()
+}
+
+func initSearch() {
+	searchIndexFile = viper.GetString("search.indexfile")
+	initSearchIndex(viper.GetBool("search.rebuild"), searchIndexFile)
+}
+
+func initRender() {
+	bodyRenderer = render.New(render.Options{
+		LineNumbers: viper.GetBool("render.linenumbers"),
+	})
+}
+
+func initMedia() {
+	dir := viper.GetString("media.dir")
+	if dir == "" {
+		dir = "media"
+	}
+	initBlobStore(dir)
+
+	if mediaMaxSize = viper.GetInt64("media.maxsize"); mediaMaxSize <= 0 {
+		mediaMaxSize = defaultMediaMaxSize
+	}
+	setMediaTypes(viper.GetStringSlice("media.types"))
+}
+
+func initFeed() {
+	siteURL = viper.GetString("page.url")
+	if feedTitle = viper.GetString("feed.title"); feedTitle == "" {
+		feedTitle = defaultFeedTitle
+	}
+	if feedLimit = viper.GetInt("feed.limit"); feedLimit <= 0 || feedLimit > maxPostListLimit {
+		feedLimit = defaultFeedLimit
+	}
+}
+
+func initLogin() {
+	second := func(key string) time.Duration {
+		return time.Duration(viper.GetInt64(key)) * time.Second
+	}
+	setLoginLimits(viper.GetInt("login.attempts"), viper.GetInt("login.ipattempts"),
+		second("login.lockout"), second("login.maxlockout"), second("login.window"))
+}
+
+func initRobots() {
+	robotsDisallow = viper.GetStringSlice("robots.disallow")
+	robotsExtra = viper.GetString("robots.extra")
+}
+
 func initDebugMode() {
 	debugPage = viper.GetBool("debug.page")
 	debugViewCode = viper.GetBool("debug.viewcode")
@@ -101,6 +169,12 @@ func initPagePrefix() {
 
 func initDBHandler() {
 
+	// a local sqlite file replaces the mysql service if it is configured
+	if sqlitePath = viper.GetString("service.sqlite.path"); sqlitePath != "" {
+		initSqliteHandler(sqlitePath)
+		return
+	}
+
 	cfg := mysql.Config{
 		Addr:                 viper.GetString("service.mysql.addr"),
 		User:                 viper.GetString("service.mysql.user"),
@@ -159,7 +233,9 @@ func initDataAnalysis() {
 }
 
 func initFuncMap() {
-	funcMap = template.FuncMap{"add": add, "multiple": multiple}
+	funcMap = template.FuncMap{"add": add, "multiple": multiple,
+		"statuses": statuses, "tagsize": tagSize, "join": strings.Join,
+		"srcset": srcset, "mediaurl": mediaURL, "csrfinput": csrfInput}
 }
 
 func initTemplate() {
@@ -178,47 +254,15 @@ func initTemplate() {
 		templpath+"templ/analysis.html",
 		templpath+"templ/useradmin.html",
 		templpath+"templ/alert.html",
+		templpath+"templ/history.html",
+		templpath+"templ/diff.html",
+		templpath+"templ/tag.html",
+		templpath+"templ/moderation.html",
+		templpath+"templ/sessions.html",
+		templpath+"templ/lockouts.html",
+		templpath+"templ/search.html",
+		templpath+"templ/postlist.html",
 		templpath+"templ/inspect.html",
 	)
 	templates = template.Must(t, err)
 }
-
-func initDBTables() {
-
-	if !viper.GetBool("debug.initdbtable") {
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
-	defer cancel()
-
-	//	q := `ALTER DATABASE blog CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
-	q := `CREATE TABLE IF NOT EXISTS post(
-          id        INT AUTO_INCREMENT NOT NULL,
-          title     TINYTEXT NOT NULL,
-          author    VARCHAR(10) NOT NULL,
-          ctime     DATETIME NOT NULL,
-          mtime     DATETIME NOT NULL,
-          body      LONGTEXT,
-          PRIMARY KEY (id)
-        );
-        CREATE TABLE IF NOT EXISTS poststatistics(
-          postid    INT NOT NULL UNIQUE,
-          star1    INT NOT NULL DEFAULT 0,
-          star2    INT NOT NULL DEFAULT 0,
-          star3    INT NOT NULL DEFAULT 0,
-          star4    INT NOT NULL DEFAULT 0,
-          star5    INT NOT NULL DEFAULT 0,
-          PRIMARY KEY (postid)
-        );
-        CREATE TABLE IF NOT EXISTS users (
-          username  VARCHAR(10) NOT NULL,
-          password  VARCHAR(1024) NOT NULL,` +
-		"`rank`" + `ENUM('bronze','silver','gold') NOT NULL,
-          PRIMARY KEY (username)
-        );`
-
-	if _, err := db.ExecContext(ctx, q); err != nil {
-		log.Fatal(err)
-	}
-}
@@ -0,0 +1,68 @@
+package blog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hzget/goblog/blog/render"
+	"github.com/hzget/goblog/blog/sanitize"
+)
+
+type previewReq struct {
+	Body   string `json:"body"`
+	Format string `json:"format"`
+}
+
+type previewResp struct {
+	jsonResp
+	HTML string `json:"html"`
+}
+
+/* markdown renderer of the post bodies, set up by the config */
+var bodyRenderer = render.New(render.Options{})
+
+// renderBody turns a post body into html: markdown is rendered and
+// sanitized, plain text is escaped and keeps its line breaks
+func renderBody(format, body string) (string, error) {
+	switch format {
+	case FormatMarkdown:
+		html, err := bodyRenderer.Markdown(body)
+		if err != nil {
+			return "", err
+		}
+		return sanitize.Post.Sanitize(html), nil
+	case FormatText, "":
+		return "<pre>" + getHTMLEscapeString(body) + "</pre>", nil
+	default:
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// previewjsHandler renders a body being edited without saving it
+func previewjsHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appError {
+
+	var req = &previewReq{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	if info.Username == "superadmin" {
+		return &appError{errors.New("the user is not allowed to edit post"),
+			http.StatusBadRequest}
+	}
+
+	html, err := renderBody(req.Format, req.Body)
+	if err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	// the html may contain a %, so the response is not a format
+	fmt.Fprint(w, encodeJson(&previewResp{jsonResp{true, ""}, html}))
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package blog
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hzget/goblog/blog/frontmatter"
+)
+
+// mdPost is a markdown file to import and what becomes of it
+type mdPost struct {
+	File string
+	Post *Post
+	// the post here that it is already, or why it cannot be imported
+	Exists int64
+	Skip   string
+}
+
+var (
+	mdDatePrefix = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}-`)
+	mdNotTag     = regexp.MustCompile(`[^0-9a-z_\-]+`)
+)
+
+// ImportMarkdown imports a directory of markdown posts with a front
+// matter, as kept by Hugo or Jekyll. It only shows what it would create
+// unless it is told to apply:
+//
+//	import-md [-author name] [-apply] dir
+func ImportMarkdown(args []string) error {
+
+	fs := flag.NewFlagSet("import-md", flag.ContinueOnError)
+	author := fs.String("author", "", "the author of the posts without a user here in their front matter")
+	apply := fs.Bool("apply", false, "create the posts, without it nothing is written")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: goblog import-md [-author name] [-apply] dir")
+	}
+
+	initArchive()
+	defer closeLogFile()
+
+	posts, err := readMarkdownDir(fs.Arg(0), *author)
+	if err != nil {
+		return err
+	}
+
+	if err := checkMarkdownAuthors(posts, *author); err != nil {
+		return err
+	}
+
+	existing, err := existingPosts()
+	if err != nil {
+		return err
+	}
+
+	n := planMarkdownImport(posts, existing)
+	for _, mp := range posts {
+		switch {
+		case mp.Skip != "":
+			fmt.Printf("skip    %s: %s\n", mp.File, mp.Skip)
+		case mp.Exists != 0:
+			fmt.Printf("exists  %s: post %d\n", mp.File, mp.Exists)
+		default:
+			p := mp.Post
+			fmt.Printf("create  %s: %q by %s, %s, %s, tags %v\n", mp.File, p.Title, p.Author,
+				p.Date.Format("2006-01-02 15:04"), p.Status, p.Tags)
+		}
+	}
+
+	if !*apply {
+		fmt.Printf("%d posts to create, run again with -apply to create them\n", n)
+		return nil
+	}
+
+	created := 0
+	for _, mp := range posts {
+		if mp.Skip != "" || mp.Exists != 0 {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+		err := insertImportedPost(ctx, mp.Post)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %w", mp.File, err)
+		}
+		created++
+	}
+	fmt.Printf("%d posts created\n", created)
+	if created > 0 {
+		fmt.Println(rebuildHint)
+	}
+
+	return nil
+}
+
+// readMarkdownDir reads the markdown files under dir. The section pages
+// of Hugo, _index.md, are not posts.
+func readMarkdownDir(dir, author string) ([]mdPost, error) {
+
+	var posts []mdPost
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if info.IsDir() || ext != ".md" && ext != ".markdown" || info.Name() == "_index.md" {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		mp := mdPost{File: rel}
+		if mp.Post, err = markdownPost(rel, data, info, author); err != nil {
+			mp.Skip = err.Error()
+		}
+		posts = append(posts, mp)
+
+		return nil
+	})
+
+	return posts, err
+}
+
+// markdownPost maps a markdown file onto a post. What the front matter
+// misses is taken from the file: the title from its name and the
+// creation time from its mtime.
+func markdownPost(name string, data []byte, info os.FileInfo, author string) (*Post, error) {
+
+	doc, err := frontmatter.Parse(name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Post{
+		Title:    doc.Title,
+		Author:   doc.Author,
+		Date:     doc.Date,
+		Modified: doc.Modified,
+		Body:     doc.Body,
+		Status:   StatusPublished,
+		Format:   FormatMarkdown,
+	}
+
+	if p.Title == "" {
+		base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+		p.Title = strings.NewReplacer("-", " ", "_", " ").Replace(mdDatePrefix.ReplaceAllString(base, ""))
+	}
+
+	if match, _ := regexp.MatchString(regexUsername, p.Author); !match {
+		if author == "" {
+			return nil, fmt.Errorf("no valid author %q, give one with -author", p.Author)
+		}
+		p.Author = author
+	}
+
+	if p.Date.IsZero() {
+		p.Date = info.ModTime()
+	}
+	// the post was published when it was written, a draft never was
+	if !doc.Draft {
+		p.PublishAt = p.Date
+	}
+	if p.Modified.Before(p.Date) {
+		p.Modified = p.Date
+	}
+
+	if doc.Draft {
+		p.Status = StatusDraft
+	}
+
+	if p.Tags, err = markdownTags(doc.Tags); err != nil {
+		return nil, err
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// markdownTags turns the tags of a front matter, like "Go Lang", into
+// the ones of goblog, "go-lang", and keeps as many as a post can have
+func markdownTags(tags []string) ([]string, error) {
+
+	var slugs []string
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = strings.Trim(mdNotTag.ReplaceAllString(strings.ToLower(t), "-"), "-")
+		if len(t) > 32 {
+			t = t[:32]
+		}
+		if t == "" || seen[t] || len(slugs) == maxPostTag {
+			continue
+		}
+		seen[t] = true
+		slugs = append(slugs, t)
+	}
+
+	return normalizeTags(slugs)
+}
+
+// checkMarkdownAuthors makes sure the posts are by users here. A post
+// of an unknown author is given to the one of -author, or else skipped.
+func checkMarkdownAuthors(posts []mdPost, author string) error {
+
+	known := map[string]bool{}
+	exists := func(name string) (bool, error) {
+		if ok, checked := known[name]; checked {
+			return ok, nil
+		}
+		ok, err := checkUserExist(name)
+		if err != nil {
+			return false, err
+		}
+		known[name] = ok
+		return ok, nil
+	}
+
+	if author != "" {
+		if ok, err := exists(author); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("no user %q to give the posts to", author)
+		}
+	}
+
+	for i := range posts {
+		mp := &posts[i]
+		if mp.Skip != "" {
+			continue
+		}
+
+		ok, err := exists(mp.Post.Author)
+		if err != nil {
+			return err
+		}
+		switch {
+		case ok:
+		case author == "":
+			mp.Skip = fmt.Sprintf("no user %q, give one with -author", mp.Post.Author)
+		default:
+			mp.Post.Author = author
+		}
+	}
+
+	return nil
+}
+
+// planMarkdownImport finds the posts that are here already, the same
+// way an archive import does, and returns the number of posts to create
+func planMarkdownImport(posts []mdPost, existing map[string]*Post) int {
+
+	n := 0
+	for i := range posts {
+		mp := &posts[i]
+		if mp.Skip != "" {
+			continue
+		}
+
+		key := postKey(mp.Post)
+		if old, ok := existing[key]; ok {
+			if old.Id == 0 {
+				mp.Skip = "the same post as another file"
+			} else {
+				mp.Exists = old.Id
+			}
+			continue
+		}
+
+		// a later file of the same post is not created twice
+		existing[key] = mp.Post
+		n++
+	}
+
+	return n
+}
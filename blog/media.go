@@ -0,0 +1,581 @@
+package blog
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/hzget/goblog/blog/blob"
+	"github.com/hzget/goblog/blog/imaging"
+)
+
+// Attachment is a file uploaded to a post, its content is the blob of Key
+type Attachment struct {
+	Id     int64     `json:"id"`
+	PostId int64     `json:"postid"`
+	Author string    `json:"author"`
+	Name   string    `json:"name"`
+	Type   string    `json:"type"`
+	Size   int64     `json:"size"`
+	Key    string    `json:"key"`
+	Date   time.Time `json:"date"`
+	// the size of an image in pixels, 0 for other files
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type mediaReq struct {
+	Id     int64 `json:"id"`
+	PostId int64 `json:"postid"`
+}
+
+type mediaResp struct {
+	jsonResp
+	Attachment *Attachment `json:"attachment"`
+}
+
+type mediaListResp struct {
+	jsonResp
+	Attachments []Attachment `json:"attachments"`
+}
+
+const (
+	defaultMediaMaxSize = 10 << 20
+	maxMediaNameLen     = 255
+	// the time to write or remove blobs, longer than a query
+	blobDuration = 30 * time.Second
+	// a blob never changes once written, but its post may be unpublished
+	// or deleted, so a shared cache keeps it a short while and asks again
+	mediaMaxAge = 300
+)
+
+/* set up by the config */
+var blobStore blob.Store
+var mediaMaxSize int64 = defaultMediaMaxSize
+
+// the content types that may be uploaded and the extension of their blobs
+var mediaTypes = map[string]string{
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"image/gif":       ".gif",
+	"application/pdf": ".pdf",
+	"text/plain":      ".txt",
+}
+
+func initBlobStore(dir string) {
+	fs, err := blob.NewFS(dir)
+	if err != nil {
+		panic(err)
+	}
+	blobStore = fs
+}
+
+// setMediaTypes limits the uploads to the types, which is
+// every type known to mediaTypes if types is empty
+func setMediaTypes(types []string) {
+
+	if len(types) == 0 {
+		return
+	}
+
+	allowed := map[string]string{}
+	for _, t := range types {
+		ext, ok := mediaTypes[t]
+		if !ok {
+			Warn("unknown media type " + t)
+			continue
+		}
+		allowed[t] = ext
+	}
+	mediaTypes = allowed
+}
+
+// the image types of which variants are made, and their imaging format
+var imageFormats = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpeg",
+	"image/gif":  "gif",
+}
+
+var variantTypes = map[string]string{"png": "image/png", "jpeg": "image/jpeg"}
+var variantExts = map[string]string{"png": ".png", "jpeg": ".jpg"}
+
+// IsImage reports whether the attachment can be shown by an <img>
+func (a *Attachment) IsImage() bool {
+	return strings.HasPrefix(a.Type, "image/")
+}
+
+// Variants returns the resized variants of the image, smallest first
+func (a *Attachment) Variants() []imaging.Variant {
+
+	if _, ok := imageFormats[a.Type]; !ok {
+		return nil
+	}
+
+	var vs []imaging.Variant
+	for _, v := range imaging.Variants {
+		if a.Width <= v.Width {
+			break
+		}
+		vs = append(vs, v)
+	}
+
+	return vs
+}
+
+func (a *Attachment) hasVariant(name string) bool {
+	for _, v := range a.Variants() {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Attachment) variantFormat() string {
+	return imaging.VariantFormat(imageFormats[a.Type])
+}
+
+// mediaKeyBase is the key without its extension, the variants of
+// an image share it
+func mediaKeyBase(key string) string {
+	return strings.TrimSuffix(key, filepath.Ext(key))
+}
+
+// variantKey is the blob of a variant, next to the one of the attachment
+func (a *Attachment) variantKey(name string) string {
+	return mediaKeyBase(a.Key) + "_" + name + variantExts[a.variantFormat()]
+}
+
+// blobKeys returns the blobs of the attachment and its variants
+func (a *Attachment) blobKeys() []string {
+	keys := []string{a.Key}
+	for _, v := range a.Variants() {
+		keys = append(keys, a.variantKey(v.Name))
+	}
+	return keys
+}
+
+// mediaURL is the url of the variant of the attachment, or of the
+// attachment itself if there is no such variant
+func mediaURL(a Attachment, variant string) string {
+	if a.hasVariant(variant) {
+		return sitePrefix + "/media/" + variant + "/" + a.Key
+	}
+	return sitePrefix + "/media/" + a.Key
+}
+
+// srcset lists the variants of an image and the image itself by width,
+// for the browser to pick the one that fits the screen
+func srcset(a Attachment) string {
+
+	if a.Width == 0 {
+		return ""
+	}
+
+	var s []string
+	for _, v := range a.Variants() {
+		s = append(s, fmt.Sprintf("%s %dw", mediaURL(a, v.Name), v.Width))
+	}
+	s = append(s, fmt.Sprintf("%s %dw", mediaURL(a, ""), a.Width))
+
+	return strings.Join(s, ", ")
+}
+
+func getAttachment(id int64) (*Attachment, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	return attachmentStore.GetAttachment(ctx, id)
+}
+
+func getAttachments(postid int64) ([]Attachment, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	return attachmentStore.ListAttachments(ctx, postid)
+}
+
+// cleanImage removes the metadata of the image and makes its variants,
+// it sets the size of the attachment to the ones of the cleaned image
+func cleanImage(a *Attachment, content io.Reader) ([]byte, []imaging.Resized, error) {
+
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	img, err := imaging.Clean(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid image: %w", err)
+	}
+
+	variants, err := img.Resize()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid image: %w", err)
+	}
+
+	a.Size, a.Width, a.Height = int64(len(img.Data)), img.Width, img.Height
+
+	return img.Data, variants, nil
+}
+
+// saveAttachment stores the content and the variants as new blobs and
+// records the attachment, the blobs are removed again if it cannot be recorded
+func saveAttachment(a *Attachment, content io.Reader, variants []imaging.Resized) error {
+
+	fail := func(err error) error {
+		return fmt.Errorf("fail to save attachment: %w", err)
+	}
+
+	// an imported attachment comes with its key and time
+	if a.Key == "" {
+		a.Key = uuid.NewString() + mediaTypes[a.Type]
+	}
+	if a.Date.IsZero() {
+		a.Date = time.Now()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), blobDuration)
+	defer cancel()
+
+	keys := []string{a.Key}
+	err := blobStore.Put(ctx, a.Key, content)
+	for i := 0; i < len(variants) && err == nil; i++ {
+		key := a.variantKey(variants[i].Name)
+		keys = append(keys, key)
+		err = blobStore.Put(ctx, key, bytes.NewReader(variants[i].Data))
+	}
+	if err == nil {
+		err = attachmentStore.AddAttachment(ctx, a)
+	}
+
+	if err != nil {
+		removeBlobs(keys...)
+		return fail(err)
+	}
+
+	return nil
+}
+
+func deleteAttachment(a *Attachment) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	if err := attachmentStore.DeleteAttachment(ctx, a.Id); err != nil {
+		return err
+	}
+	removeBlobs(a.blobKeys()...)
+
+	return nil
+}
+
+// removeBlobs removes the blobs of the attachments no longer recorded.
+// A blob it fails to remove is only logged: nothing refers to it anymore.
+func removeBlobs(keys ...string) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), blobDuration)
+	defer cancel()
+
+	for _, key := range keys {
+		if err := blobStore.Delete(ctx, key); err != nil {
+			Warn(fmt.Sprintf("fail to remove blob %s: %v", key, err))
+		}
+	}
+}
+
+// detectMediaType sniffs the type of the content rather than trusting
+// the one claimed by the client
+func detectMediaType(head []byte) (string, error) {
+
+	t, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := mediaTypes[t]; !ok {
+		return "", fmt.Errorf("the type %s is not allowed", t)
+	}
+
+	return t, nil
+}
+
+func cleanMediaName(name string) string {
+
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" {
+		return "file"
+	}
+
+	for utf8.RuneCountInString(name) > maxMediaNameLen {
+		_, n := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-n]
+	}
+
+	return name
+}
+
+// loadPostEditPermission checks that the user can edit the post the
+// media belongs to
+func loadPostEditPermission(postid int64, info *PageInfo) *appError {
+
+	if postid <= 0 {
+		return &appError{errors.New("save the post before attaching files to it"),
+			http.StatusBadRequest}
+	}
+
+	info.Id = postid
+	perm, err := info.getPermisson()
+	if err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	if perm&PermEdit == 0 {
+		return &appError{errors.New("the user is not allowed to edit post"),
+			http.StatusBadRequest}
+	}
+
+	return nil
+}
+
+// uploadHandler receives a multipart form of a postid and a file
+func uploadHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appError {
+
+	if r.Method != http.MethodPost {
+		return &appError{errors.New("the method is not allowed"),
+			http.StatusMethodNotAllowed}
+	}
+
+	// the form fields and the multipart framing come on top of the file
+	r.Body = http.MaxBytesReader(w, r.Body, mediaMaxSize+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	postid, err := strconv.ParseInt(r.FormValue("postid"), 10, 64)
+	if err != nil {
+		return &appError{errors.New("invalid post id"), http.StatusBadRequest}
+	}
+
+	if e := loadPostEditPermission(postid, info); e != nil {
+		return e
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+	defer file.Close()
+
+	if header.Size > mediaMaxSize {
+		return &appError{fmt.Errorf("the file is larger than %d bytes", mediaMaxSize),
+			http.StatusRequestEntityTooLarge}
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	ctype, err := detectMediaType(head[:n])
+	if err != nil {
+		return &appError{err, http.StatusUnsupportedMediaType}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	a := &Attachment{
+		PostId: postid,
+		Author: info.Username,
+		Name:   cleanMediaName(header.Filename),
+		Type:   ctype,
+		Size:   header.Size,
+	}
+
+	var content io.Reader = file
+	var variants []imaging.Resized
+	if _, ok := imageFormats[ctype]; ok {
+		data, vs, err := cleanImage(a, file)
+		if err != nil {
+			return &appError{err, http.StatusBadRequest}
+		}
+		content, variants = bytes.NewReader(data), vs
+	}
+
+	if err := saveAttachment(a, content, variants); err != nil {
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	fmt.Fprint(w, encodeJson(&mediaResp{jsonResp{true, ""}, a}))
+
+	return nil
+}
+
+// mediajsHandler lists the attachments of a post for the media picker
+func mediajsHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appError {
+
+	var req = &mediaReq{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	if e := loadPostEditPermission(req.PostId, info); e != nil {
+		return e
+	}
+
+	as, err := getAttachments(req.PostId)
+	if err != nil {
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	if as == nil {
+		as = []Attachment{}
+	}
+
+	// the file names may contain a %, so the response is not a format
+	fmt.Fprint(w, encodeJson(&mediaListResp{jsonResp{true, ""}, as}))
+
+	return nil
+}
+
+func deletemediajsHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appError {
+
+	var req = &mediaReq{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	a, err := getAttachment(req.Id)
+	switch {
+	case err == sql.ErrNoRows:
+		return &appError{fmt.Errorf("no attachment %d", req.Id), http.StatusBadRequest}
+	case err != nil:
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	if e := loadPostEditPermission(a.PostId, info); e != nil {
+		return e
+	}
+
+	if err := deleteAttachment(a); err != nil {
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	fmt.Fprint(w, encodeJson(&mediaResp{jsonResp{true, ""}, a}))
+
+	return nil
+}
+
+// mediaHandler serves an attachment, /media/#key, or a variant of an
+// image, /media/#variant/#key, to the readers of its post
+func mediaHandler(w http.ResponseWriter, r *http.Request) {
+
+	key := strings.TrimPrefix(r.URL.Path, sitePrefix+"/media/")
+	variant := ""
+	if i := strings.IndexByte(key, '/'); i >= 0 {
+		variant, key = key[:i], key[i+1:]
+	}
+	if !blob.ValidKey(key) {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	a, err := attachmentStore.GetAttachmentByKey(ctx, key)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	blobKey, ctype, size := a.Key, a.Type, a.Size
+	if variant != "" {
+		if !a.hasVariant(variant) {
+			http.NotFound(w, r)
+			return
+		}
+		blobKey, ctype, size = a.variantKey(variant), variantTypes[a.variantFormat()], 0
+	}
+
+	// anonymous readers see the media of the published posts only
+	username, _ := ValidateSession(w, r)
+	perm, err := (&PageInfo{Username: username, Id: a.PostId}).getPermisson()
+	if err != nil || perm&(PermView|PermEdit) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	post, err := loadPost(a.PostId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the media of a post not published are kept out of shared caches,
+	// and the reader's one asks each time whether they may still be seen
+	cache := fmt.Sprintf("public, max-age=%d, must-revalidate", mediaMaxAge)
+	if post.Status != StatusPublished {
+		cache = "private, no-cache"
+	}
+	w.Header().Set("Cache-Control", cache)
+	etag := `"` + blobKey + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	content, err := blobStore.Get(ctx, blobKey)
+	switch {
+	case err == blob.ErrNotFound:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", ctype)
+	if size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if !a.IsImage() {
+		w.Header().Set("Content-Disposition",
+			mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+	}
+
+	io.Copy(w, content)
+}
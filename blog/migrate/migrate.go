@@ -0,0 +1,259 @@
+// Package migrate applies numbered sql migration files to a database and
+// records the applied versions in the schema_migrations table.
+//
+// A migration consists of two files in the root of a file system:
+//
+//	0001_init.up.sql
+//	0001_init.down.sql
+//
+// The number is the version and the name is informational. The down file
+// is optional; a migration without it can not be reverted.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+var ErrIrreversible = errors.New("migration has no down file")
+
+var fileRe = regexp.MustCompile(`^([0-9]+)_([0-9a-zA-Z_]+)\.(up|down)\.sql$`)
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+          version    BIGINT NOT NULL,
+          name       VARCHAR(255) NOT NULL,
+          applied_at DATETIME NOT NULL,
+          PRIMARY KEY (version)
+        )`
+
+// Load reads the migration files in the root of fsys sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[int64]*Migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		m := fileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", e.Name())
+		}
+
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version %q", e.Name())
+		}
+
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mg, ok := found[version]
+		if !ok {
+			mg = &Migration{Version: version, Name: m[2]}
+			found[version] = mg
+		}
+		if mg.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %q and %q",
+				version, mg.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mg.Up = string(b)
+		} else {
+			mg.Down = string(b)
+		}
+	}
+
+	var ms []Migration
+	for _, mg := range found {
+		if mg.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file",
+				mg.Version, mg.Name)
+		}
+		ms = append(ms, *mg)
+	}
+
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+
+	return ms, nil
+}
+
+// New returns a Migrator for the migration files in fsys.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	ms, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: ms}, nil
+}
+
+// Latest returns the highest version known by the migration files.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Applied returns the applied versions in ascending order.
+func (m *Migrator) Applied(ctx context.Context) ([]int64, error) {
+
+	if _, err := m.db.ExecContext(ctx, createTable); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx,
+		`SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var versions []int64
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// Version returns the highest applied version, 0 for an empty database.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	versions, err := m.Applied(ctx)
+	if err != nil || len(versions) == 0 {
+		return 0, err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// Pending returns the migrations that are not applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+
+	versions, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]bool, len(versions))
+	for _, v := range versions {
+		applied[v] = true
+	}
+
+	var ms []Migration
+	for _, mg := range m.migrations {
+		if !applied[mg.Version] {
+			ms = append(ms, mg)
+		}
+	}
+
+	return ms, nil
+}
+
+// Up applies all pending migrations and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+
+	ms, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, mg := range ms {
+		q := `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`
+		if err := m.exec(ctx, mg.Up, q, mg.Version, mg.Name, time.Now()); err != nil {
+			return ms[:i], fmt.Errorf("migration %d_%s up: %w", mg.Version, mg.Name, err)
+		}
+	}
+
+	return ms, nil
+}
+
+// Down reverts the last n applied migrations and returns them.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+
+	versions, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int64]Migration, len(m.migrations))
+	for _, mg := range m.migrations {
+		known[mg.Version] = mg
+	}
+
+	var done []Migration
+	for i := len(versions) - 1; i >= 0 && len(done) < n; i-- {
+		mg, ok := known[versions[i]]
+		if !ok {
+			return done, fmt.Errorf("migration %d is unknown to this binary", versions[i])
+		}
+		if mg.Down == "" {
+			return done, fmt.Errorf("migration %d_%s: %w", mg.Version, mg.Name, ErrIrreversible)
+		}
+
+		q := `DELETE FROM schema_migrations WHERE version = ?`
+		if err := m.exec(ctx, mg.Down, q, mg.Version); err != nil {
+			return done, fmt.Errorf("migration %d_%s down: %w", mg.Version, mg.Name, err)
+		}
+		done = append(done, mg)
+	}
+
+	return done, nil
+}
+
+// exec runs the migration script and the bookkeeping query in a transaction.
+// attention: mysql commits DDL statements implicitly, so a failed script
+// may leave a partially migrated schema behind.
+func (m *Migrator) exec(ctx context.Context, script, q string, args ...interface{}) error {
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
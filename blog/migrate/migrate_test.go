@@ -0,0 +1,176 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+)
+
+var files = fstest.MapFS{
+	"0001_init.up.sql":     {Data: []byte(`CREATE TABLE post (id INTEGER PRIMARY KEY, title TEXT);`)},
+	"0001_init.down.sql":   {Data: []byte(`DROP TABLE post;`)},
+	"0002_body.up.sql":     {Data: []byte(`ALTER TABLE post ADD COLUMN body TEXT;`)},
+	"0002_body.down.sql":   {Data: []byte(`ALTER TABLE post DROP COLUMN body;`)},
+	"0003_author.up.sql":   {Data: []byte(`ALTER TABLE post ADD COLUMN author TEXT;`)},
+	"0003_author.down.sql": {Data: []byte(`ALTER TABLE post DROP COLUMN author;`)},
+}
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", "file:"+t.TempDir()+"/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLoad(t *testing.T) {
+	ms, err := Load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ms) != 3 {
+		t.Fatalf("want 3 migrations, got %d", len(ms))
+	}
+
+	for i, want := range []int64{1, 2, 3} {
+		if ms[i].Version != want {
+			t.Fatalf("migration %d: want version %d, got %d", i, want, ms[i].Version)
+		}
+	}
+
+	if ms[1].Name != "body" || ms[1].Up == "" || ms[1].Down == "" {
+		t.Fatalf("migration 2 is unexpected: %#v", ms[1])
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	cases := []struct {
+		name string
+		fs   fstest.MapFS
+	}{
+		{"BadName", fstest.MapFS{"init.sql": {Data: []byte(`x`)}}},
+		{"NoUp", fstest.MapFS{"0001_init.down.sql": {Data: []byte(`x`)}}},
+		{"TwoNames", fstest.MapFS{
+			"0001_init.up.sql":  {Data: []byte(`x`)},
+			"0001_other.up.sql": {Data: []byte(`x`)},
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Load(tc.fs); err == nil {
+				t.Fatal("want an error, got nil")
+			}
+		})
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+
+	m, err := New(db, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Latest() != 3 {
+		t.Fatalf("want latest 3, got %d", m.Latest())
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 3 {
+		t.Fatalf("want 3 applied migrations, got %d", len(applied))
+	}
+
+	if _, err := db.Exec(`INSERT INTO post (title, body, author) VALUES ('t', 'b', 'a')`); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second run is a no-op
+	applied, err = m.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("want no migration applied, got %d, %v", len(applied), err)
+	}
+
+	reverted, err := m.Down(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 2 || reverted[0].Version != 3 || reverted[1].Version != 2 {
+		t.Fatalf("want versions 3 and 2 reverted, got %#v", reverted)
+	}
+
+	v, err := m.Version(ctx)
+	if err != nil || v != 1 {
+		t.Fatalf("want version 1, got %d, %v", v, err)
+	}
+
+	if _, err := db.Exec(`SELECT body FROM post`); err == nil {
+		t.Fatal("column body still exists after down")
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("want 2 pending migrations, got %d, %v", len(pending), err)
+	}
+}
+
+func TestUpFailure(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+
+	fs := fstest.MapFS{
+		"0001_init.up.sql":   {Data: []byte(`CREATE TABLE post (id INTEGER PRIMARY KEY);`)},
+		"0002_broken.up.sql": {Data: []byte(`ALTER TABLE nosuchtable ADD COLUMN x TEXT;`)},
+	}
+
+	m, err := New(db, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err == nil {
+		t.Fatal("want an error, got nil")
+	}
+	if len(applied) != 1 {
+		t.Fatalf("want 1 applied migration, got %d", len(applied))
+	}
+
+	v, err := m.Version(ctx)
+	if err != nil || v != 1 {
+		t.Fatalf("want version 1, got %d, %v", v, err)
+	}
+}
+
+func TestDownIrreversible(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+
+	fs := fstest.MapFS{
+		"0001_init.up.sql": {Data: []byte(`CREATE TABLE post (id INTEGER PRIMARY KEY);`)},
+	}
+
+	m, err := New(db, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Down(ctx, 1); !errors.Is(err, ErrIrreversible) {
+		t.Fatalf("want %v, got %v", ErrIrreversible, err)
+	}
+}
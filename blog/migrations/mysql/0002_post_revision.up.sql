@@ -0,0 +1,13 @@
+CREATE TABLE postrevision(
+  id        INT AUTO_INCREMENT NOT NULL,
+  postid    INT NOT NULL,
+  author    VARCHAR(10) NOT NULL,
+  ctime     DATETIME NOT NULL,
+  title     TINYTEXT NOT NULL,
+  body      LONGTEXT,
+  PRIMARY KEY (id),
+  INDEX (postid)
+);
+-- the current content of each post is its first revision
+INSERT INTO postrevision (postid, author, ctime, title, body)
+  SELECT id, author, mtime, title, body FROM post;
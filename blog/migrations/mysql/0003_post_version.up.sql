@@ -0,0 +1 @@
+ALTER TABLE post ADD COLUMN version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+DROP INDEX post_status_publish_at ON post;
+ALTER TABLE post DROP COLUMN publish_at, DROP COLUMN status;
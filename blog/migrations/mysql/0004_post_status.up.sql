@@ -0,0 +1,6 @@
+ALTER TABLE post
+  ADD COLUMN status ENUM('draft','published','scheduled','archived') NOT NULL DEFAULT 'published',
+  ADD COLUMN publish_at DATETIME NULL;
+UPDATE post SET publish_at = ctime;
+ALTER TABLE post MODIFY publish_at DATETIME NOT NULL;
+CREATE INDEX post_status_publish_at ON post (status, publish_at);
@@ -0,0 +1,2 @@
+DROP TABLE posttag;
+DROP TABLE tag;
@@ -0,0 +1,11 @@
+CREATE TABLE tag(
+  id        INT AUTO_INCREMENT NOT NULL,
+  name      VARCHAR(32) NOT NULL UNIQUE,
+  PRIMARY KEY (id)
+);
+CREATE TABLE posttag(
+  postid    INT NOT NULL,
+  tagid     INT NOT NULL,
+  PRIMARY KEY (postid, tagid),
+  INDEX (tagid)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE comment(
+  id        INT AUTO_INCREMENT NOT NULL,
+  postid    INT NOT NULL,
+  parentid  INT NOT NULL DEFAULT 0,
+  author    VARCHAR(10) NOT NULL,
+  ctime     DATETIME NOT NULL,
+  mtime     DATETIME NOT NULL,
+  body      TEXT NOT NULL,
+  deleted   BOOLEAN NOT NULL DEFAULT FALSE,
+  PRIMARY KEY (id),
+  INDEX (postid)
+);
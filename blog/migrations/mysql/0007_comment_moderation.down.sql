@@ -0,0 +1,2 @@
+DROP INDEX comment_status ON comment;
+ALTER TABLE comment DROP COLUMN moderator, DROP COLUMN status;
@@ -0,0 +1,4 @@
+ALTER TABLE comment
+  ADD COLUMN status ENUM('approved','pending','rejected') NOT NULL DEFAULT 'approved',
+  ADD COLUMN moderator VARCHAR(10) NOT NULL DEFAULT '';
+CREATE INDEX comment_status ON comment (status);
@@ -0,0 +1 @@
+ALTER TABLE post ADD COLUMN format ENUM('text','markdown') NOT NULL DEFAULT 'text';
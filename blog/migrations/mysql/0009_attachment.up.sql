@@ -0,0 +1,13 @@
+CREATE TABLE attachment(
+  id        INT AUTO_INCREMENT NOT NULL,
+  postid    INT NOT NULL,
+  author    VARCHAR(10) NOT NULL,
+  name      VARCHAR(255) NOT NULL,
+  ctype     VARCHAR(100) NOT NULL,
+  size      BIGINT NOT NULL,
+  blobkey   VARCHAR(128) NOT NULL,
+  ctime     DATETIME NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE (blobkey),
+  INDEX (postid)
+);
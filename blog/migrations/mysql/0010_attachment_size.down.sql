@@ -0,0 +1,3 @@
+ALTER TABLE attachment
+  DROP COLUMN height,
+  DROP COLUMN width;
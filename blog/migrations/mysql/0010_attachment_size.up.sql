@@ -0,0 +1,3 @@
+ALTER TABLE attachment
+  ADD COLUMN width INT NOT NULL DEFAULT 0,
+  ADD COLUMN height INT NOT NULL DEFAULT 0;
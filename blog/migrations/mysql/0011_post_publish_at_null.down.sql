@@ -0,0 +1,2 @@
+UPDATE post SET publish_at = ctime WHERE publish_at IS NULL;
+ALTER TABLE post MODIFY publish_at DATETIME NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE post MODIFY publish_at DATETIME NULL;
+UPDATE post SET publish_at = NULL WHERE status = 'draft';
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS post(
+  id        INTEGER PRIMARY KEY AUTOINCREMENT,
+  title     TEXT NOT NULL,
+  author    VARCHAR(10) NOT NULL,
+  ctime     DATETIME NOT NULL,
+  mtime     DATETIME NOT NULL,
+  body      TEXT
+);
+CREATE TABLE IF NOT EXISTS poststatistics(
+  postid    INTEGER NOT NULL PRIMARY KEY,
+  star1     INTEGER NOT NULL DEFAULT 0,
+  star2     INTEGER NOT NULL DEFAULT 0,
+  star3     INTEGER NOT NULL DEFAULT 0,
+  star4     INTEGER NOT NULL DEFAULT 0,
+  star5     INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS users (
+  username  VARCHAR(10) NOT NULL PRIMARY KEY,
+  password  VARCHAR(1024) NOT NULL,
+  `rank`    TEXT NOT NULL CHECK (`rank` IN ('bronze','silver','gold'))
+);
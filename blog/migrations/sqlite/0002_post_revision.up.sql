@@ -0,0 +1,12 @@
+CREATE TABLE postrevision(
+  id        INTEGER PRIMARY KEY AUTOINCREMENT,
+  postid    INTEGER NOT NULL,
+  author    VARCHAR(10) NOT NULL,
+  ctime     DATETIME NOT NULL,
+  title     TEXT NOT NULL,
+  body      TEXT
+);
+CREATE INDEX postrevision_postid ON postrevision (postid);
+-- the current content of each post is its first revision
+INSERT INTO postrevision (postid, author, ctime, title, body)
+  SELECT id, author, mtime, title, body FROM post;
@@ -0,0 +1,3 @@
+DROP INDEX post_status_publish_at;
+ALTER TABLE post DROP COLUMN publish_at;
+ALTER TABLE post DROP COLUMN status;
@@ -0,0 +1,5 @@
+ALTER TABLE post ADD COLUMN status TEXT NOT NULL DEFAULT 'published'
+  CHECK (status IN ('draft','published','scheduled','archived'));
+ALTER TABLE post ADD COLUMN publish_at DATETIME NOT NULL DEFAULT '';
+UPDATE post SET publish_at = ctime;
+CREATE INDEX post_status_publish_at ON post (status, publish_at);
@@ -0,0 +1,10 @@
+CREATE TABLE tag(
+  id        INTEGER PRIMARY KEY AUTOINCREMENT,
+  name      VARCHAR(32) NOT NULL UNIQUE
+);
+CREATE TABLE posttag(
+  postid    INTEGER NOT NULL,
+  tagid     INTEGER NOT NULL,
+  PRIMARY KEY (postid, tagid)
+);
+CREATE INDEX posttag_tagid ON posttag (tagid);
@@ -0,0 +1,11 @@
+CREATE TABLE comment(
+  id        INTEGER PRIMARY KEY AUTOINCREMENT,
+  postid    INTEGER NOT NULL,
+  parentid  INTEGER NOT NULL DEFAULT 0,
+  author    VARCHAR(10) NOT NULL,
+  ctime     DATETIME NOT NULL,
+  mtime     DATETIME NOT NULL,
+  body      TEXT NOT NULL,
+  deleted   BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX comment_postid ON comment (postid);
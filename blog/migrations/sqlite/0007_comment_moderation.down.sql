@@ -0,0 +1,3 @@
+DROP INDEX comment_status;
+ALTER TABLE comment DROP COLUMN moderator;
+ALTER TABLE comment DROP COLUMN status;
@@ -0,0 +1,4 @@
+ALTER TABLE comment ADD COLUMN status TEXT NOT NULL DEFAULT 'approved'
+  CHECK (status IN ('approved','pending','rejected'));
+ALTER TABLE comment ADD COLUMN moderator VARCHAR(10) NOT NULL DEFAULT '';
+CREATE INDEX comment_status ON comment (status);
@@ -0,0 +1,2 @@
+ALTER TABLE post ADD COLUMN format TEXT NOT NULL DEFAULT 'text'
+  CHECK (format IN ('text','markdown'));
@@ -0,0 +1,11 @@
+CREATE TABLE attachment(
+  id        INTEGER PRIMARY KEY AUTOINCREMENT,
+  postid    INTEGER NOT NULL,
+  author    VARCHAR(10) NOT NULL,
+  name      VARCHAR(255) NOT NULL,
+  ctype     VARCHAR(100) NOT NULL,
+  size      BIGINT NOT NULL,
+  blobkey   VARCHAR(128) NOT NULL UNIQUE,
+  ctime     DATETIME NOT NULL
+);
+CREATE INDEX attachment_postid ON attachment (postid);
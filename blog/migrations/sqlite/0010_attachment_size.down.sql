@@ -0,0 +1,2 @@
+ALTER TABLE attachment DROP COLUMN height;
+ALTER TABLE attachment DROP COLUMN width;
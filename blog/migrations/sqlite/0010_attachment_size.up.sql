@@ -0,0 +1,2 @@
+ALTER TABLE attachment ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE attachment ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+DROP INDEX post_status_publish_at;
+ALTER TABLE post RENAME COLUMN publish_at TO publish_at_old;
+ALTER TABLE post ADD COLUMN publish_at DATETIME;
+UPDATE post SET publish_at = publish_at_old WHERE status != 'draft';
+ALTER TABLE post DROP COLUMN publish_at_old;
+CREATE INDEX post_status_publish_at ON post (status, publish_at);
@@ -0,0 +1,180 @@
+package blog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hzget/goblog/blog/spam"
+)
+
+// SpamClassifier tells spam comments from the others.
+// It learns from the decisions of the moderators.
+type SpamClassifier interface {
+	// SpamProb returns the probability in [0, 1] that the text is spam.
+	SpamProb(text string) float64
+	// Train learns that the text is spam or not.
+	Train(text string, isSpam bool)
+}
+
+type moderateReq struct {
+	Id      int64 `json:"id"`
+	Approve bool  `json:"approve"`
+}
+
+type pendingComment struct {
+	Comment
+	Title    string
+	SpamProb float64
+}
+
+/* not thread-safe: assigned once during initialization */
+var spamClassifier SpamClassifier
+var moderateAll bool
+var spamThreshold float64
+
+const defaultSpamThreshold = 0.9
+
+// initSpamClassifier trains the classifier with the decisions made so far
+func initSpamClassifier() {
+
+	spamClassifier = spam.NewNaiveBayes()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	cs, err := commentStore.ListModeratedComments(ctx)
+	if err != nil {
+		Warn("fail to train the spam classifier: " + err.Error())
+		return
+	}
+
+	for _, c := range cs {
+		spamClassifier.Train(c.Body, c.Status == CommentRejected)
+	}
+	Info(fmt.Sprintf("spam classifier trained with %d comments", len(cs)))
+}
+
+// screenComment returns the status a new or edited comment shall be saved with.
+// a comment that looks like spam is held for moderation.
+func screenComment(c *Comment) string {
+
+	if IsAdmin(c.Author) {
+		return CommentApproved
+	}
+
+	if moderateAll || spamClassifier.SpamProb(c.Body) >= spamThreshold {
+		return CommentPending
+	}
+
+	return CommentApproved
+}
+
+func commentSavedMsg(c *Comment) string {
+	if c.Status == CommentPending {
+		return "the comment is held for moderation"
+	}
+	return "save success"
+}
+
+func getPendingComments() ([]pendingComment, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	cs, err := commentStore.ListCommentsByStatus(ctx, CommentPending)
+	if err != nil {
+		return nil, err
+	}
+
+	var pcs []pendingComment
+	for _, c := range cs {
+		if c.Deleted {
+			continue
+		}
+
+		p, err := loadPost(c.PostId)
+		if err != nil {
+			return nil, err
+		}
+
+		pcs = append(pcs, pendingComment{c, p.Title, spamClassifier.SpamProb(c.Body)})
+	}
+
+	return pcs, nil
+}
+
+// moderateComment approves or rejects a pending comment
+// and teaches the classifier the decision
+func moderateComment(id int64, approve bool, moderator string) error {
+
+	c, err := getComment(id)
+	if err != nil {
+		return err
+	}
+
+	status := CommentRejected
+	if approve {
+		status = CommentApproved
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	if err := commentStore.ModerateComment(ctx, id, status, moderator); err != nil {
+		return err
+	}
+
+	spamClassifier.Train(c.Body, !approve)
+
+	return nil
+}
+
+func moderationHandler(w http.ResponseWriter, r *http.Request) {
+
+	data, err := getPendingComments()
+	if err != nil {
+		printAlert(w, fmt.Sprintf("get pending comments failed: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	renderTemplate(w, "moderation.html", data)
+}
+
+func moderatejsHandler(w http.ResponseWriter, r *http.Request) {
+
+	var req = &moderateReq{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		http.Error(w, encodeJsonResp(false, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	// the session is validated by makeAdminHandler, the user cookie
+	// is not the one of the session
+	moderator, err := currentSession(nil, r)
+	if err != nil {
+		RespondError(w, err)
+		return
+	}
+
+	err = moderateComment(req.Id, req.Approve, moderator.User)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, encodeJsonResp(false, fmt.Sprintf("no pending comment %d", req.Id)),
+			http.StatusBadRequest)
+		return
+	case err != nil:
+		fmt.Printf("internal error %v\n", err)
+		http.Error(w, encodeJsonResp(false, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(w, encodeJsonResp(true, "moderate success"))
+}
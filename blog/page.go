@@ -24,6 +24,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type appError struct {
@@ -36,9 +37,14 @@ type viewReq struct {
 }
 
 type saveReq struct {
-	Id    int64  `json:"id"`
-	Title string `json:"title"`
-	Body  string `json:"body"`
+	Id        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Version   int64     `json:"version"`
+	Status    string    `json:"status"`
+	PublishAt time.Time `json:"publishat"`
+	Tags      []string  `json:"tags"`
+	Format    string    `json:"format"`
 }
 
 type viewResp struct {
@@ -48,7 +54,15 @@ type viewResp struct {
 
 type saveResp struct {
 	jsonResp
-	Id int64 `json:"id"`
+	Id      int64 `json:"id"`
+	Version int64 `json:"version"`
+}
+
+// conflictResp carries the current server copy of a post
+// when a save is based on a stale version
+type conflictResp struct {
+	jsonResp
+	Post
 }
 
 type jsonResp struct {
@@ -70,26 +84,17 @@ const (
 
 func frontpageHandler(w http.ResponseWriter, r *http.Request) {
 
-	data := struct {
-		ViewCode bool
-	}{debugViewCode}
-
-	renderTemplate(w, "frontpage.html", data)
-}
-
-func postlistHandler(w http.ResponseWriter, r *http.Request) {
-
-	data, err := getPostsInfo()
+	tags, err := getTagCounts()
 	if err != nil {
-		printAlert(w, err.Error(), http.StatusInternalServerError)
-		return
+		Warn("fail to get tag counts: " + err.Error())
 	}
 
-	for i := 0; i < len(data); i++ {
-		data[i].Body = getHTMLEscapeString(data[i].Body)
-	}
+	data := struct {
+		ViewCode bool
+		Tags     []TagCount
+	}{debugViewCode, tags}
 
-	renderTemplate(w, "postlist.html", data)
+	renderTemplate(w, "frontpage.html", data)
 }
 
 func handleErr(w http.ResponseWriter, r *http.Request, err error) {
@@ -116,7 +121,7 @@ func viewHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) {
 		return
 	}
 
-	data, err := getViewData(info)
+	data, err := getViewData(info, csrfToken(r))
 	switch {
 	case err == sql.ErrNoRows:
 		printAlert(w, err.Error(), http.StatusBadRequest)
@@ -243,12 +248,58 @@ func savejsHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appE
 			http.StatusBadRequest}
 	}
 
-	var post = &Post{Id: req.Id, Title: req.Title, Body: req.Body, Author: info.Username}
-	if err := post.save(); err != nil {
+	// nil tags keep the current ones
+	var tags []string
+	if req.Tags != nil {
+		if tags, err = normalizeTags(req.Tags); err != nil {
+			return &appError{err, http.StatusBadRequest}
+		}
+	}
+
+	var post = &Post{Id: req.Id, Title: req.Title, Body: req.Body,
+		Author: info.Username, Version: req.Version,
+		Status: req.Status, PublishAt: req.PublishAt, Tags: tags,
+		Format: req.Format}
+
+	// a client that does not know the status or format keeps the current one
+	if req.Status == "" && req.Id != 0 {
+		if err := post.keepStatus(); err != nil {
+			return &appError{err, http.StatusInternalServerError}
+		}
+	}
+	if req.Format == "" && req.Id != 0 {
+		if err := post.keepFormat(); err != nil {
+			return &appError{err, http.StatusInternalServerError}
+		}
+	}
+	err = post.save()
+	switch {
+	case errors.Is(err, ErrVersionConflict):
+		return respondConflict(w, req.Id)
+	case err != nil:
 		return &appError{err, http.StatusInternalServerError}
 	}
 
-	fmt.Fprintf(w, encodeJsonSaveResp(true, "save success", post.Id))
+	fmt.Fprintf(w, encodeJsonSaveResp(true, "save success", post.Id, post.Version))
+
+	return nil
+}
+
+// respondConflict sends the current copy of the post so that
+// the client can merge it with the rejected content
+func respondConflict(w http.ResponseWriter, id int64) *appError {
+
+	// the cached copy may be the stale one
+	DBRemoveCache(Key_SQL_loadPost + fmt.Sprintf("%d", id))
+
+	current, err := loadPost(id)
+	if err != nil {
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	http.Error(w, encodeJson(&conflictResp{
+		jsonResp{false, ErrVersionConflict.Error()}, *current}),
+		http.StatusConflict)
 
 	return nil
 }
@@ -275,8 +326,8 @@ func encodeJsonResp(success bool, msg string) string {
 	return encodeJson(&jsonResp{success, msg})
 }
 
-func encodeJsonSaveResp(success bool, msg string, id int64) string {
-	return encodeJson(&saveResp{jsonResp{success, msg}, id})
+func encodeJsonSaveResp(success bool, msg string, id, version int64) string {
+	return encodeJson(&saveResp{jsonResp{success, msg}, id, version})
 }
 
 func encodeJsonViewResp(p PostInfo) string {
@@ -361,7 +412,7 @@ func makePageHandler(fn func(http.ResponseWriter, *http.Request, *PageInfo) *app
 }
 
 /*
- * view: id exists
+ * view: id exists and (post is published or user == author)
  * edit: (id exists and user == author) or ( id == 0 and user is not superadmin)
  * del : id exists and is superadmin
  */
@@ -384,18 +435,28 @@ func (info *PageInfo) getPermisson() (int, error) {
 		return PermNone, err
 	}
 
+	if info.Username == post.Author {
+		return PermEdit | PermView, nil
+	}
+
+	// an unpublished post is hidden from everyone except the author
+	visible := post.IsVisibleTo(info.Username)
+
 	if info.Username == "superadmin" {
+		if !visible {
+			return PermDelete, nil
+		}
 		return PermDelete | PermView, nil
 	}
 
-	if info.Username == post.Author {
-		return PermEdit | PermView, nil
+	if !visible {
+		return PermNone, nil
 	}
 
 	return PermView, nil
 }
 
-func getViewData(info *PageInfo) (interface{}, error) {
+func getViewData(info *PageInfo, csrf string) (interface{}, error) {
 
 	pi, err := getPostInfo(info.Id)
 	if err != nil {
@@ -407,13 +468,24 @@ func getViewData(info *PageInfo) (interface{}, error) {
 		return nil, err
 	}
 
-	pi.Body = getHTMLEscapeString(pi.Body)
+	comments, err := getCommentThread(info.Id, perm, info.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := getAttachments(info.Id)
+	if err != nil {
+		return nil, err
+	}
 
 	data := struct {
 		PostInfo
-		CanEdit   bool
-		CanDelete bool
-	}{pi, perm&PermEdit > 0, perm&PermDelete > 0}
+		CanEdit     bool
+		CanDelete   bool
+		Comments    []*Comment
+		Attachments []Attachment
+		CSRF        string
+	}{pi, perm&PermEdit > 0, perm&PermDelete > 0, comments, attachments, csrf}
 
 	return data, nil
 }
@@ -7,6 +7,7 @@ import (
 )
 
 func BenchmarkViewHandler(b *testing.B) {
+	needGlobals(b)
 	handler := makeHandler(viewHandler)
 	w := httptest.NewRecorder()
 	b.ResetTimer()
@@ -18,6 +19,7 @@ func BenchmarkViewHandler(b *testing.B) {
 }
 
 func BenchmarkViewjs(b *testing.B) {
+	needGlobals(b)
 	// create req
 	handler := makePageHandler(viewjsHandler)
 
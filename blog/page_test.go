@@ -1,9 +1,18 @@
 package blog
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -11,6 +20,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 var (
@@ -21,6 +31,13 @@ var (
 )
 
 func TestMain(m *testing.M) {
+	// the -short tests run on in-memory stores or a sqlite file, without
+	// the config, mysql and redis
+	flag.Parse()
+	if testing.Short() {
+		os.Exit(m.Run())
+	}
+
 	// <setup code>
 	// be carefull! you should change config/config.json according to reality
 	//       address of mysql, redis, analysis center, and log file path
@@ -43,6 +60,14 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
+// needGlobals skips the test in -short mode, the globals it needs are
+// not set up then
+func needGlobals(tb testing.TB) {
+	if testing.Short() {
+		tb.Skip("needs the config, mysql and redis")
+	}
+}
+
 func doASignin(url, bodyJson string) *http.Response {
 
 	// create req
@@ -100,6 +125,7 @@ func signinAndSaveCookie() error {
 }
 
 func TestViewjsUnAuthorized(t *testing.T) {
+	needGlobals(t)
 	cases := []struct {
 		name, c string
 	}{
@@ -130,15 +156,517 @@ func TestViewjsUnAuthorized(t *testing.T) {
 }
 
 func TestJSHandler(t *testing.T) {
+	needGlobals(t)
 	t.Run("Viewjs", func(t *testing.T) {
 		doATest(t, makePageHandler(viewjsHandler), encodeJson(viewReq{1}), &viewResp{})
 	})
 	t.Run("Savejs", func(t *testing.T) {
-		doATest(t, makePageHandler(savejsHandler), encodeJson(saveReq{1, "S", "nihao"}), &saveResp{})
+		doATest(t, makePageHandler(savejsHandler), encodeJson(saveReq{Id: 1, Title: "S", Body: "nihao"}), &saveResp{})
 	})
 }
 
+func TestSavejsConflict(t *testing.T) {
+	needGlobals(t)
+	view := &viewResp{}
+	doATest(t, makePageHandler(viewjsHandler), encodeJson(viewReq{1}), view)
+
+	stale := view.Version
+	save := &saveResp{}
+	doATest(t, makePageHandler(savejsHandler), encodeJson(saveReq{Id: 1, Title: "S", Body: "nihao", Version: stale}), save)
+	if save.Version <= stale {
+		t.Fatalf("want version greater than %d, got %d", stale, save.Version)
+	}
+
+	conflict := &conflictResp{}
+	err := doARequest(makePageHandler(savejsHandler), "/", encodeJson(saveReq{Id: 1, Title: "S", Body: "lost", Version: stale}), conflict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conflict.Success {
+		t.Fatalf("want a rejected save, got %v", encodeJson(conflict))
+	}
+	if conflict.Version != save.Version || conflict.Body != "nihao" {
+		t.Fatalf("want the server copy of version %d, got %v", save.Version, encodeJson(conflict))
+	}
+}
+
+func TestSetPublishTime(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	for _, c := range []struct {
+		status    string
+		publishAt time.Time
+		want      string
+		wantAt    time.Time
+	}{
+		{"", time.Time{}, StatusPublished, now},
+		{StatusPublished, time.Time{}, StatusPublished, now},
+		{StatusPublished, past, StatusPublished, past},
+		{StatusPublished, future, StatusPublished, now},
+		{StatusScheduled, future, StatusScheduled, future},
+		{StatusScheduled, past, StatusPublished, past},
+		{StatusScheduled, time.Time{}, StatusPublished, now},
+		{StatusDraft, time.Time{}, StatusDraft, time.Time{}},
+		{StatusDraft, past, StatusDraft, past},
+		{StatusArchived, past, StatusArchived, past},
+	} {
+		p := &Post{Status: c.status, PublishAt: c.publishAt}
+		p.setPublishTime(now)
+		if p.Status != c.want || !p.PublishAt.Equal(c.wantAt) {
+			t.Errorf("%q at %v: want %q at %v, got %q at %v",
+				c.status, c.publishAt, c.want, c.wantAt, p.Status, p.PublishAt)
+		}
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	many := make([]string, maxPostTag+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("tag%d", i)
+	}
+
+	for _, c := range []struct {
+		tags []string
+		want []string
+		ok   bool
+	}{
+		{nil, []string{}, true},
+		{[]string{" Go ", "SQL"}, []string{"go", "sql"}, true},
+		{[]string{"go", "Go", "GO ", "", "  "}, []string{"go"}, true},
+		{[]string{"zebra", "go-lang", "a_b"}, []string{"a_b", "go-lang", "zebra"}, true},
+		{[]string{strings.Repeat("a", 32)}, []string{strings.Repeat("a", 32)}, true},
+		{[]string{strings.Repeat("a", 33)}, nil, false},
+		{[]string{"c++"}, nil, false},
+		{[]string{"two words"}, nil, false},
+		{many[:maxPostTag], nil, true},
+		{append(many[:maxPostTag:maxPostTag], "TAG0"), nil, true},
+		{many, nil, false},
+	} {
+		got, err := normalizeTags(c.tags)
+		if (err == nil) != c.ok {
+			t.Errorf("%q: want ok %v, got %v", c.tags, c.ok, err)
+			continue
+		}
+		if c.want != nil && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: want %q, got %q", c.tags, c.want, got)
+		}
+	}
+}
+
+func TestSaveTagCache(t *testing.T) {
+	needGlobals(t)
+	cached := dbcache
+	dbcache = true
+	defer func() { dbcache = cached }()
+
+	isCached := func(key string) bool {
+		var v interface{}
+		return DBGetCache(key, &v) == nil
+	}
+	fill := func(tags ...string) {
+		for _, tag := range tags {
+			if _, err := getTagPosts(tag); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := getTagCounts(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := &Post{Title: "Tagged", Author: "admin", Body: "zebrafish",
+		Status: StatusPublished, Tags: []string{"zebra"}}
+	if err := p.save(); err != nil {
+		t.Fatal(err)
+	}
+	defer DeletePost(p.Id)
+
+	// a retag drops the listings of the old and the new tags
+	fill("zebra", "okapi")
+	p.Tags = []string{"okapi"}
+	if err := p.save(); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{Key_SQL_ListTagPosts + "zebra",
+		Key_SQL_ListTagPosts + "okapi", Key_SQL_TagCounts} {
+		if isCached(key) {
+			t.Errorf("want %q dropped after a retag", key)
+		}
+	}
+	if ps, err := getTagPosts("okapi"); err != nil || len(ps) != 1 || ps[0].Id != p.Id {
+		t.Fatalf("want post %d listed under its new tag, got %+v %v", p.Id, ps, err)
+	}
+
+	// a save that keeps the tags still drops their listings, they show
+	// the title of the post
+	fill("okapi")
+	p.Title, p.Tags = "Retitled", nil
+	if err := p.save(); err != nil {
+		t.Fatal(err)
+	}
+	if isCached(Key_SQL_ListTagPosts+"okapi") || isCached(Key_SQL_TagCounts) {
+		t.Error("want the listings of the kept tags dropped")
+	}
+	if ps, err := getTagPosts("okapi"); err != nil || len(ps) != 1 || ps[0].Title != "Retitled" {
+		t.Fatalf("want the new title listed, got %+v %v", ps, err)
+	}
+
+	fill("okapi")
+	if err := DeletePost(p.Id); err != nil {
+		t.Fatal(err)
+	}
+	if isCached(Key_SQL_ListTagPosts+"okapi") || isCached(Key_SQL_TagCounts) {
+		t.Error("want the listings of the tags of a deleted post dropped")
+	}
+}
+
+func TestCommentPermission(t *testing.T) {
+	approved := &Comment{Author: "Lucy", Status: CommentApproved}
+	pending := &Comment{Author: "Lucy", Status: CommentPending}
+	rejected := &Comment{Author: "Lucy", Status: CommentRejected}
+	deleted := &Comment{Author: "Lucy", Status: CommentApproved, Deleted: true}
+
+	for _, c := range []struct {
+		postPerm int
+		username string
+		c        *Comment
+		want     int
+	}{
+		{PermView, "Lucy", approved, PermView | PermEdit | PermDelete},
+		{PermView, "Lucy", pending, PermView | PermEdit | PermDelete},
+		{PermView, "Bob", approved, PermView},
+		{PermView, "Bob", pending, PermNone},
+		{PermView, "Bob", rejected, PermNone},
+		{PermView, "Bob", deleted, PermView},
+		{PermNone, "Lucy", approved, PermNone},
+		{PermView | PermEdit, "Bob", approved, PermView | PermDelete},
+		{PermView | PermEdit, "Bob", pending, PermNone},
+
+		// the superadmin moderates whatever the status of the post
+		{PermView | PermDelete, "superadmin", approved, PermView | PermDelete},
+		{PermDelete, "superadmin", approved, PermView | PermDelete},
+		{PermDelete, "superadmin", pending, PermView | PermDelete},
+		{PermNone, "superadmin", rejected, PermView | PermDelete},
+		{PermDelete, "superadmin", deleted, PermView},
+	} {
+		if got := getCommentPermission(c.postPerm, c.username, c.c); got != c.want {
+			t.Errorf("post perm %d, %s on %+v: want %d, got %d",
+				c.postPerm, c.username, *c.c, c.want, got)
+		}
+	}
+}
+
+func TestCommentjs(t *testing.T) {
+	needGlobals(t)
+	add := &commentResp{}
+	doATest(t, makePageHandler(addcommentjsHandler), encodeJson(commentReq{PostId: 1, Body: "first"}), add)
+
+	reply := &commentResp{}
+	doATest(t, makePageHandler(addcommentjsHandler), encodeJson(commentReq{PostId: 1, ParentId: add.Id, Body: "second"}), reply)
+
+	doATest(t, makePageHandler(editcommentjsHandler), encodeJson(commentReq{Id: reply.Id, Body: "edited"}), &commentResp{})
+
+	list := &commentsResp{}
+	doATest(t, makePageHandler(commentsjsHandler), encodeJson(commentReq{PostId: 1}), list)
+
+	var found bool
+	for _, c := range list.Comments {
+		if c.Id == add.Id {
+			found = len(c.Replies) == 1 && c.Replies[0].Body == "edited"
+		}
+	}
+	if !found {
+		t.Fatalf("want comment %d replied by %d, got %v", add.Id, reply.Id, encodeJson(list))
+	}
+
+	doATest(t, makePageHandler(deletecommentjsHandler), encodeJson(commentReq{Id: reply.Id}), &commentResp{})
+	doATest(t, makePageHandler(deletecommentjsHandler), encodeJson(commentReq{Id: add.Id}), &commentResp{})
+}
+
+func TestPostlistjs(t *testing.T) {
+	needGlobals(t)
+	first := &postListResp{}
+	doATest(t, makePageHandler(postlistjsHandler), encodeJson(postListReq{Sort: SortCtime, Limit: 1}), first)
+	if len(first.Posts) != 1 || first.Next == "" {
+		t.Skipf("want at least two posts, got %v", encodeJson(first))
+	}
+
+	second := &postListResp{}
+	doATest(t, makePageHandler(postlistjsHandler), encodeJson(postListReq{Sort: SortCtime, Limit: 1, Cursor: first.Next}), second)
+	if len(second.Posts) != 1 || second.Posts[0].Id == first.Posts[0].Id {
+		t.Fatalf("want the next post after %d, got %v", first.Posts[0].Id, encodeJson(second))
+	}
+}
+
+// upload posts the file to post 1 and returns the attachment made of it
+func upload(t *testing.T, name string, data []byte) *Attachment {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("postid", "1")
+	file, _ := form.CreateFormFile("file", name)
+	file.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Cookie", cookie)
+	w := httptest.NewRecorder()
+	makePageHandler(uploadHandler)(w, req)
+
+	resp := &mediaResp{}
+	if err := decodeJson(w.Body.Bytes(), resp); err != nil || !resp.Success {
+		t.Fatalf("want the file uploaded, got %v %s", err, w.Body.String())
+	}
+	return resp.Attachment
+}
+
+func readBlob(t *testing.T, key string) []byte {
+	r, err := blobStore.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("want the blob %s, got %v", key, err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestUpload(t *testing.T) {
+	needGlobals(t)
+	var dot bytes.Buffer
+	gif.Encode(&dot, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.White}), nil)
+
+	a := upload(t, "dot.gif", dot.Bytes())
+	if a.Type != "image/gif" || a.Width != 1 || a.Height != 1 {
+		t.Fatalf("want the sniffed type image/gif of 1x1, got %v", encodeJson(a))
+	}
+
+	list := &mediaListResp{}
+	doATest(t, makePageHandler(mediajsHandler), encodeJson(mediaReq{PostId: 1}), list)
+	if len(list.Attachments) == 0 || list.Attachments[0].Id != a.Id {
+		t.Fatalf("want attachment %d listed first, got %v", a.Id, encodeJson(list))
+	}
+
+	// a reader's cache asks again after a while, the post may be unpublished
+	req := httptest.NewRequest("GET", mediaURL(*a, ""), nil)
+	w := httptest.NewRecorder()
+	mediaHandler(w, req)
+	cache := fmt.Sprintf("public, max-age=%d, must-revalidate", mediaMaxAge)
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != cache {
+		t.Fatalf("want the file cached shortly, got %d %v", w.Code, w.Header())
+	}
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	mediaHandler(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("want 304 for the same file, got %d", w.Code)
+	}
+
+	doATest(t, makePageHandler(deletemediajsHandler), encodeJson(mediaReq{Id: a.Id}), &mediaResp{})
+}
+
+func TestUploadCleansImage(t *testing.T) {
+	needGlobals(t)
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 400, 200)), nil)
+
+	// an exif segment with a camera model right after the start of image
+	exif := "Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01" +
+		"\x01\x10\x00\x02\x00\x00\x00\x04Cam\x00\x00\x00\x00\x00"
+	data := append([]byte{0xff, 0xd8, 0xff, 0xe1, 0, byte(len(exif) + 2)}, exif...)
+	data = append(data, buf.Bytes()[2:]...)
+
+	a := upload(t, "photo.jpg", data)
+	defer doATest(t, makePageHandler(deletemediajsHandler), encodeJson(mediaReq{Id: a.Id}), &mediaResp{})
+
+	stored := readBlob(t, a.Key)
+	if bytes.Contains(stored, []byte("Exif")) || int64(len(stored)) != a.Size {
+		t.Fatalf("want the exif removed from the %d bytes stored, got %d bytes", a.Size, len(stored))
+	}
+
+	thumb, err := jpeg.DecodeConfig(bytes.NewReader(readBlob(t, a.variantKey("thumb"))))
+	if err != nil || thumb.Width != 160 || thumb.Height != 80 {
+		t.Fatalf("want a thumb of 160x80, got %v %v", thumb, err)
+	}
+	if a.hasVariant("large") {
+		t.Fatalf("want no variant as wide as the image, got %v", a.Variants())
+	}
+}
+
+// useSiteURL sets page.url until the test ends
+func useSiteURL(t *testing.T, u string) {
+	old := siteURL
+	siteURL = u
+	t.Cleanup(func() { siteURL = old })
+}
+
+func TestFeed(t *testing.T) {
+	needGlobals(t)
+	useSiteURL(t, "")
+	w := httptest.NewRecorder()
+	feedHandler(FeedRSS)(w, httptest.NewRequest("GET", "http://blog.test/feed.rss", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("want no feed without page.url, got %d", w.Code)
+	}
+
+	useSiteURL(t, "http://blog.test")
+	doATest(t, makePageHandler(savejsHandler),
+		encodeJson(saveReq{Title: "Feed", Body: "feed", Status: StatusPublished}), &saveResp{})
+
+	for _, format := range []string{FeedRSS, FeedAtom, FeedJSON} {
+		req := httptest.NewRequest("GET", "http://blog.test/feed."+format, nil)
+		w := httptest.NewRecorder()
+		feedHandler(format)(w, req)
+
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != feedTypes[format] {
+			t.Fatalf("%s: want the feed, got %d %s", format, w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), "http://blog.test/view/") {
+			t.Fatalf("%s: want absolute links to the posts, got %s", format, w.Body.String())
+		}
+
+		req = httptest.NewRequest("GET", "http://blog.test/feed."+format, nil)
+		req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+		w = httptest.NewRecorder()
+		feedHandler(format)(w, req)
+		if w.Code != http.StatusNotModified {
+			t.Fatalf("%s: want 304 for an unchanged feed, got %d", format, w.Code)
+		}
+	}
+}
+
+func TestSitemap(t *testing.T) {
+	needGlobals(t)
+	useSiteURL(t, "http://blog.test")
+	w := httptest.NewRecorder()
+	sitemapHandler(w, httptest.NewRequest("GET", "http://blog.test/sitemap.xml", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<loc>http://blog.test/view/") {
+		t.Fatalf("want the urls of the posts, got %d %s", w.Code, w.Body.String())
+	}
+
+	if n := sitemapParts(2*sitemapMaxURLs + 1); n != 3 {
+		t.Fatalf("want 3 sitemaps, got %d", n)
+	}
+
+	w = httptest.NewRecorder()
+	robotsHandler(w, httptest.NewRequest("GET", "http://blog.test/robots.txt", nil))
+	for _, p := range robotsPrivate {
+		if !strings.Contains(w.Body.String(), "Disallow: "+sitePrefix+p+"\n") {
+			t.Fatalf("want %s disallowed, got %s", p, w.Body.String())
+		}
+	}
+}
+
+func TestArchive(t *testing.T) {
+	needGlobals(t)
+	var archive bytes.Buffer
+	m, err := exportArchive(&archive, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the posts of the archive are all here already
+	rep, err := importArchive(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Created != 0 || len(rep.Users) != 0 || rep.Unchanged+len(rep.Conflicts) < len(m.Posts) {
+		t.Fatalf("want nothing imported again, got %+v", rep)
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	needGlobals(t)
+	rep := &importReport{}
+	users := []UserInfo{{"admin", "gold"}, {"imported", "silver"}}
+	if err := importUsers(users, rep); err != nil {
+		t.Fatal(err)
+	}
+	defer (&Credentials{Username: "imported"}).remove()
+
+	if !reflect.DeepEqual(rep.Users, []string{"imported"}) {
+		t.Fatalf("want the new user reported, got %v", rep.Users)
+	}
+}
+
+func TestInsertImportedPost(t *testing.T) {
+	needGlobals(t)
+	date := time.Date(2015, 7, 8, 0, 0, 0, 0, time.UTC)
+	p := &Post{Title: "Imported", Author: "admin", Date: date, Modified: date,
+		Body: "zebrafish", Status: StatusPublished, Tags: []string{"zebra"}}
+	if err := insertImportedPost(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	defer DeletePost(p.Id)
+
+	if !p.PublishAt.Equal(date) || p.Format != FormatText {
+		t.Fatalf("want the post published at its date as text, got %+v", p)
+	}
+	if tags, err := getPostTags(p.Id); err != nil || !reflect.DeepEqual(tags, []string{"zebra"}) {
+		t.Fatalf("want the tags of post %d, got %v %v", p.Id, tags, err)
+	}
+	if rs, err := getRevisions(p.Id); err != nil || len(rs) != 1 || !rs[0].Date.Equal(date) {
+		t.Fatalf("want a first revision of post %d, got %+v %v", p.Id, rs, err)
+	}
+
+	bad := &Post{Title: "Bad", Author: "no one", Date: date, Modified: date, Status: StatusPublished}
+	if err := insertImportedPost(context.Background(), bad); err == nil {
+		DeletePost(bad.Id)
+		t.Fatal("want an invalid author refused")
+	}
+
+	for _, c := range []struct {
+		c       Comment
+		deleted bool
+		valid   bool
+	}{
+		{Comment{Author: "admin", Body: "hi", Status: CommentApproved}, false, true},
+		{Comment{Author: "admin", Status: CommentApproved}, true, true},
+		{Comment{Author: "admin", Status: CommentApproved}, false, false},
+		{Comment{Author: "admin", Body: "hi", Status: "spam"}, false, false},
+	} {
+		if err := validImportedComment(&c.c, c.deleted); (err == nil) != c.valid {
+			t.Errorf("%+v deleted %v: want valid %v, got %v", c.c, c.deleted, c.valid, err)
+		}
+	}
+}
+
+func TestMarkdownImport(t *testing.T) {
+	needGlobals(t)
+	dir := t.TempDir()
+	ioutil.WriteFile(dir+"/2015-07-08-old-post.md", []byte("---\ntags: [Go Lang]\n---\nhello\n"), 0644)
+	ioutil.WriteFile(dir+"/_index.md", []byte("+++\ntitle = \"Posts\"\n+++\n"), 0644)
+
+	posts, err := readMarkdownDir(dir, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].Skip != "" {
+		t.Fatalf("want one post to import, got %+v", posts)
+	}
+
+	p := posts[0].Post
+	if p.Title != "old post" || p.Author != "admin" || p.Date.Format("2006-01-02") != "2015-07-08" ||
+		!p.PublishAt.Equal(p.Date) || len(p.Tags) != 1 || p.Tags[0] != "go-lang" {
+		t.Fatalf("want the post of the file, got %+v", p)
+	}
+
+	// a dry run writes nothing
+	if n := planMarkdownImport(posts, map[string]*Post{}); n != 1 {
+		t.Fatalf("want 1 post to create, got %d", n)
+	}
+}
+
 func TestPressureViewjs(t *testing.T) {
+	needGlobals(t)
 	t.Run("AlreadyCached(Parallel=1000)", func(t *testing.T) {
 		testPressureViewjs(t, true, 1000)
 	})
@@ -151,7 +679,7 @@ func testPressureViewjs(t *testing.T, cached bool, N int) {
 	if cached {
 		doATest(t, makePageHandler(viewjsHandler), encodeJson(viewReq{1}), &viewResp{})
 	} else {
-		doATest(t, makePageHandler(savejsHandler), encodeJson(saveReq{1, "S", "nihao"}), &saveResp{})
+		doATest(t, makePageHandler(savejsHandler), encodeJson(saveReq{Id: 1, Title: "S", Body: "nihao"}), &saveResp{})
 	}
 	var wg sync.WaitGroup
 	for i := 0; i < N; i++ {
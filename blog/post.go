@@ -3,6 +3,7 @@ package blog
 import (
 	"context"
 	"fmt"
+	"html/template"
 	"regexp"
 	"strconv"
 	"sync/atomic"
@@ -10,14 +11,35 @@ import (
 )
 
 type Post struct {
-	Id       int64     `json:"id"`
-	Title    string    `json:"title"`
-	Author   string    `json:"author"`
-	Date     time.Time `json:"date"`
-	Modified time.Time `json:"modified"`
-	Body     string    `json:"body"`
+	Id        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Author    string    `json:"author"`
+	Date      time.Time `json:"date"`
+	Modified  time.Time `json:"modified"`
+	Body      string    `json:"body"`
+	Version   int64     `json:"version"`
+	Status    string    `json:"status"`
+	PublishAt time.Time `json:"publishat"`
+	Tags      []string  `json:"tags"`
+	Format    string    `json:"format"`
 }
 
+// the lifecycle of a post: only a published post is visible to readers
+// other than the author. a scheduled post is published by the scheduler
+// once its PublishAt is reached.
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+	StatusScheduled = "scheduled"
+	StatusArchived  = "archived"
+)
+
+// the markup of a post body
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+)
+
 const (
 	regexId        = `^[0-9]+$`
 	regexTitle_Neg = `^[ ]*$`
@@ -36,6 +58,52 @@ type PostStatistics struct {
 type PostInfo struct {
 	Post
 	Star [5]int64 `json:"star"`
+	// the body rendered to sanitized html, cached together with the post
+	HTML template.HTML `json:"html"`
+}
+
+// PostSummary is a post in a list: no body but an excerpt of it
+// and the vote statistics
+type PostSummary struct {
+	Id        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Author    string    `json:"author"`
+	Date      time.Time `json:"date"`
+	Modified  time.Time `json:"modified"`
+	Status    string    `json:"status"`
+	PublishAt time.Time `json:"publishat"`
+	Excerpt   string    `json:"excerpt"`
+	Votes     int64     `json:"votes"`
+	Stars     float64   `json:"stars"`
+}
+
+// PostStamp is a post and the time it was last modified
+type PostStamp struct {
+	Id       int64
+	Modified time.Time
+}
+
+// the keys a post list can be sorted by
+const (
+	SortCtime = "ctime"
+	SortMtime = "mtime"
+	SortStars = "stars"
+	SortVotes = "votes"
+	// the time a post is out, for the feeds
+	SortPublished = "published"
+)
+
+// PostListQuery selects a page of the posts visible to Viewer.
+// The page starts after the post (AfterKey, AfterId) in the sort order
+// if AfterId > 0, the key is of the type of the sort key.
+type PostListQuery struct {
+	Viewer   string
+	Author   string
+	Sort     string
+	Asc      bool
+	Limit    int
+	AfterKey interface{}
+	AfterId  int64
 }
 
 func loadPost(id int64) (*Post, error) {
@@ -60,18 +128,15 @@ func loadPost(id int64) (*Post, error) {
 		return nil, &limitErr{nil, s}
 	}
 
-	q := Key_SQL_loadPost + `?`
-	row := db.QueryRowContext(ctx, q, id)
-	err := row.Scan(&p.Id, &p.Title, &p.Author, &p.Date, &p.Modified, &p.Body)
-
+	post, err := postStore.LoadPost(ctx, id)
 	if err != nil {
 		Info("loadPost:" + err.Error())
 		return nil, err
 	}
 
-	DBUpdateCache(key, &p)
+	DBUpdateCache(key, post)
 
-	return &p, err
+	return post, nil
 }
 
 func (p *Post) Validate() error {
@@ -103,17 +168,90 @@ func (p *Post) Validate() error {
 		return fail("Post.Author:"+p.Author, err)
 	}
 
+	switch p.Status {
+	case StatusDraft, StatusPublished, StatusScheduled, StatusArchived:
+	default:
+		return fail("Post.Status:"+p.Status, nil)
+	}
+
+	switch p.Format {
+	case FormatText, FormatMarkdown:
+	default:
+		return fail("Post.Format:"+p.Format, nil)
+	}
+
+	return nil
+}
+
+// IsVisibleTo reports whether the user can read the post
+func (p *Post) IsVisibleTo(username string) bool {
+	return p.Status == StatusPublished || p.Author == username
+}
+
+// keepStatus copies the status and the publish time of the stored post
+func (p *Post) keepStatus() error {
+
+	current, err := loadPost(p.Id)
+	if err != nil {
+		return err
+	}
+
+	p.Status, p.PublishAt = current.Status, current.PublishAt
+
+	return nil
+}
+
+// keepFormat copies the format of the stored post
+func (p *Post) keepFormat() error {
+
+	current, err := loadPost(p.Id)
+	if err != nil {
+		return err
+	}
+
+	p.Format = current.Format
+
 	return nil
 }
 
+// setPublishTime settles the status and the publish time at a save:
+// a post without a status is published, a scheduled post whose time
+// has come is published right away, and a post published now gets
+// now as its publish time. A draft or an archived post keeps the time
+// it was published at, if ever.
+func (p *Post) setPublishTime(now time.Time) {
+
+	if p.Status == "" {
+		p.Status = StatusPublished
+	}
+
+	if p.Status == StatusScheduled && !p.PublishAt.After(now) {
+		p.Status = StatusPublished
+	}
+
+	if p.Status == StatusPublished && (p.PublishAt.IsZero() || p.PublishAt.After(now)) {
+		p.PublishAt = now
+	}
+}
+
 // shall check if user exists in the db. otherwise, there maybe issues
 // for example, the login user is removed from db, but login session
 // is valid in redis, then the user sends a "create page" command,
 // this invalid user creates the page successfully!
+//
+// an existing post with a Version other than 0 is only saved if nobody
+// saved it in between, otherwise the error wraps ErrVersionConflict.
 func (p *Post) save() error {
 
 	fail := func(err error) error {
-		return fmt.Errorf("save page failed: %v", err)
+		return fmt.Errorf("save page failed: %w", err)
+	}
+
+	var now = time.Now()
+	p.setPublishTime(now)
+
+	if p.Format == "" {
+		p.Format = FormatText
 	}
 
 	if err := p.Validate(); err != nil {
@@ -123,42 +261,63 @@ func (p *Post) save() error {
 	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
 	defer cancel()
 
-	var now = time.Now()
-
-	if p.Id == 0 {
-		q := "INSERT INTO post (title, author, ctime, mtime, body) VALUES (?, ?, ?, ?, ?)"
-		result, err := db.ExecContext(ctx, q, p.Title, p.Author, now, now, p.Body)
-		if err != nil {
-			return fail(err)
-		}
+	update := p.Id != 0
+	if update {
+		p.Modified = now
+	} else {
+		p.Date, p.Modified = now, now
+	}
 
-		id, err := result.LastInsertId()
-		if err != nil {
-			return fail(err)
-		}
-		p.Id = id
+	// every save is kept as an immutable revision, and the post, its
+	// revision and its tags are saved together
+	r := &Revision{Author: p.Author, Date: now, Title: p.Title, Body: p.Body}
+	old, err := postStore.SavePost(ctx, p, r)
+	if err != nil {
+		return fail(err)
+	}
 
-	} else {
-		q := "UPDATE post set title = ?, body = ?, mtime = ? where id = ?"
-		_, err := db.ExecContext(ctx, q, p.Title, p.Body, now, p.Id)
-		if err != nil {
-			return fail(err)
-		}
+	if update {
 		id := fmt.Sprintf("%d", p.Id)
 		DBRemoveCache(Key_SQL_GetPostInfo + id)
 		DBRemoveCache(Key_SQL_loadPost + id)
 	}
 
+	// nil tags keep the current ones
+	if p.Tags == nil {
+		p.Tags = old
+	}
+
+	// the tag listings show the title and status of the post
+	removeTagCache(append(old, p.Tags...)...)
+
+	indexPost(p)
+
 	return nil
 }
 
 func DeletePost(id int64) error {
 
-	q := `DELETE FROM post WHERE id = ?`
-	_, err := db.Exec(q, id)
+	removePostTagCache(id)
+
+	// the blobs are removed once the post no longer refers to them
+	as, err := getAttachments(id)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	err = postStore.DeletePost(ctx, id)
 	s := fmt.Sprintf("%d", id)
 	DBRemoveCache(Key_SQL_GetPostInfo + s)
 	DBRemoveCache(Key_SQL_loadPost + s)
+	if err == nil {
+		searchIndex.Remove(id)
+		for _, a := range as {
+			removeBlobs(a.blobKeys()...)
+		}
+	}
 	return err
 }
 
@@ -184,59 +343,31 @@ func getPostInfo(id int64) (PostInfo, error) {
 		return p, &limitErr{nil, s}
 	}
 
-	row := db.QueryRowContext(ctx, Key_SQL_GetPostInfo+"?", id)
-	err := row.Scan(&p.Id, &p.Title, &p.Author, &p.Date, &p.Modified, &p.Body,
-		&p.Star[0], &p.Star[1], &p.Star[2], &p.Star[3], &p.Star[4])
-
+	info, err := postStore.GetPostInfo(ctx, id)
 	if err != nil {
 		Info("getPostInfo:" + err.Error())
-		return p, err
+		return info, err
 	}
 
-	DBUpdateCache(key, &p)
-
-	return p, err
-}
-
-func getPostsInfo() ([]PostInfo, error) {
-
-	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
-	defer cancel()
-
-	var ps []PostInfo
-	q := `SELECT post.*, ` +
-		`IFNULL(poststatistics.star1,0), ` +
-		`IFNULL(poststatistics.star2,0), ` +
-		`IFNULL(poststatistics.star3,0), ` +
-		`IFNULL(poststatistics.star4,0), ` +
-		`IFNULL(poststatistics.star5,0)  ` +
-		`FROM post ` +
-		`LEFT JOIN poststatistics ` +
-		`ON post.id = poststatistics.postid`
-
-	rows, err := db.QueryContext(ctx, q)
-
+	// the rendered body is cached with the post, so it is rendered
+	// once per change instead of once per view
+	html, err := renderBody(info.Format, info.Body)
 	if err != nil {
-		return nil, err
+		return info, err
 	}
+	info.HTML = template.HTML(html)
 
-	defer rows.Close()
+	DBUpdateCache(key, &info)
 
-	for rows.Next() {
-		var p PostInfo
-		if err := rows.Scan(&p.Id, &p.Title, &p.Author, &p.Date, &p.Modified, &p.Body,
-			&p.Star[0], &p.Star[1], &p.Star[2], &p.Star[3], &p.Star[4]); err != nil {
-			return nil, err
-		}
+	return info, nil
+}
 
-		ps = append(ps, p)
-	}
+func getPostSummaries(q *PostListQuery) ([]PostSummary, error) {
 
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
 
-	return ps, nil
+	return postStore.ListPostSummaries(ctx, q)
 }
 
 func getAuthorsInfo() ([]string, error) {
@@ -244,29 +375,5 @@ func getAuthorsInfo() ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
 	defer cancel()
 
-	var info []string
-	q := `SELECT DISTINCT author FROM post ORDER BY author`
-
-	rows, err := db.QueryContext(ctx, q)
-
-	if err != nil {
-		return nil, err
-	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		var a string
-		if err := rows.Scan(&a); err != nil {
-			return nil, err
-		}
-
-		info = append(info, a)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return info, nil
+	return postStore.ListAuthors(ctx)
 }
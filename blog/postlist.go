@@ -0,0 +1,257 @@
+package blog
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type postListReq struct {
+	Author string `json:"author"`
+	Sort   string `json:"sort"`
+	Order  string `json:"order"`
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+}
+
+type postListResp struct {
+	jsonResp
+	Posts []PostSummary `json:"posts"`
+	Next  string        `json:"next"`
+}
+
+// postCursor is the position of the last post of a page in the sort
+// order. It is handed to the client as an opaque string.
+type postCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Key   string `json:"k"`
+	Id    int64  `json:"id"`
+}
+
+const (
+	postListLimit    = 20
+	maxPostListLimit = 100
+)
+
+// query checks the request and turns it into a query of the posts
+// visible to the viewer
+func (req *postListReq) query(viewer string) (*PostListQuery, error) {
+
+	if req.Sort == "" {
+		req.Sort = SortCtime
+	}
+	switch req.Sort {
+	case SortCtime, SortMtime, SortStars, SortVotes:
+	default:
+		return nil, fmt.Errorf("invalid sort key %q", req.Sort)
+	}
+
+	if req.Order == "" {
+		req.Order = "desc"
+	}
+	if req.Order != "asc" && req.Order != "desc" {
+		return nil, fmt.Errorf("invalid order %q", req.Order)
+	}
+
+	if req.Limit <= 0 || req.Limit > maxPostListLimit {
+		req.Limit = postListLimit
+	}
+
+	q := &PostListQuery{Viewer: viewer, Author: req.Author, Sort: req.Sort,
+		Asc: req.Order == "asc", Limit: req.Limit}
+
+	if req.Cursor == "" {
+		return q, nil
+	}
+
+	c, err := decodePostCursor(req.Cursor)
+	if err != nil || c.Sort != req.Sort || c.Order != req.Order {
+		return nil, fmt.Errorf("invalid cursor %q", req.Cursor)
+	}
+
+	if q.AfterKey, err = parseSortKey(c.Sort, c.Key); err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", req.Cursor)
+	}
+	q.AfterId = c.Id
+
+	return q, nil
+}
+
+// listPosts returns a page of posts and the cursor of the next page,
+// the cursor is empty on the last page
+func listPosts(req *postListReq, q *PostListQuery) ([]PostSummary, string, error) {
+
+	// one more post tells whether there is a next page
+	q.Limit++
+	ps, err := getPostSummaries(q)
+	q.Limit--
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(ps) <= q.Limit {
+		return ps, "", nil
+	}
+
+	ps = ps[:q.Limit]
+	last := ps[len(ps)-1]
+	next := encodePostCursor(&postCursor{req.Sort, req.Order, sortKey(&last, req.Sort), last.Id})
+
+	return ps, next, nil
+}
+
+func sortKey(p *PostSummary, sort string) string {
+	switch sort {
+	case SortMtime:
+		return p.Modified.Format(time.RFC3339Nano)
+	case SortPublished:
+		return p.PublishAt.Format(time.RFC3339Nano)
+	case SortStars:
+		return strconv.FormatFloat(p.Stars, 'g', -1, 64)
+	case SortVotes:
+		return strconv.FormatInt(p.Votes, 10)
+	default:
+		return p.Date.Format(time.RFC3339Nano)
+	}
+}
+
+func parseSortKey(sort, key string) (interface{}, error) {
+	switch sort {
+	case SortCtime, SortMtime, SortPublished:
+		return time.Parse(time.RFC3339Nano, key)
+	case SortStars:
+		return strconv.ParseFloat(key, 64)
+	case SortVotes:
+		return strconv.ParseInt(key, 10, 64)
+	default:
+		return nil, fmt.Errorf("invalid sort key %q", sort)
+	}
+}
+
+func encodePostCursor(c *postCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePostCursor(s string) (*postCursor, error) {
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var c postCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+
+	if c.Id <= 0 {
+		return nil, fmt.Errorf("invalid post id %d", c.Id)
+	}
+
+	return &c, nil
+}
+
+func postlistHandler(w http.ResponseWriter, r *http.Request) {
+
+	// anonymous readers see the published posts only
+	username, _ := ValidateSession(w, r)
+
+	limit, _ := strconv.Atoi(r.FormValue("n"))
+	req := &postListReq{
+		Author: r.FormValue("author"),
+		Sort:   r.FormValue("sort"),
+		Order:  r.FormValue("order"),
+		Cursor: r.FormValue("cursor"),
+		Limit:  limit,
+	}
+
+	q, err := req.query(username)
+	if err != nil {
+		printAlert(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	posts, next, err := listPosts(req, q)
+	if err != nil {
+		printAlert(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	authors, err := getAuthorsInfo()
+	if err != nil {
+		printAlert(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page, err := strconv.Atoi(r.FormValue("page"))
+	if err != nil || page < 1 || req.Cursor == "" {
+		page = 1
+	}
+
+	params := url.Values{}
+	params.Set("sort", req.Sort)
+	params.Set("order", req.Order)
+	if req.Author != "" {
+		params.Set("author", req.Author)
+	}
+	if limit > 0 {
+		params.Set("n", strconv.Itoa(req.Limit))
+	}
+	firstURL := "./postlist?" + params.Encode()
+
+	var nextURL string
+	if next != "" {
+		params.Set("cursor", next)
+		params.Set("page", strconv.Itoa(page+1))
+		nextURL = "./postlist?" + params.Encode()
+	}
+
+	data := struct {
+		Req      *postListReq
+		Authors  []string
+		Sorts    []string
+		Posts    []PostSummary
+		Page     int
+		FirstURL string
+		NextURL  string
+	}{req, authors, []string{SortCtime, SortMtime, SortStars, SortVotes},
+		posts, page, firstURL, nextURL}
+
+	renderTemplate(w, "postlist.html", data)
+}
+
+func postlistjsHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appError {
+
+	var req = &postListReq{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	q, err := req.query(info.Username)
+	if err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	posts, next, err := listPosts(req, q)
+	if err != nil {
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	if posts == nil {
+		posts = []PostSummary{}
+	}
+
+	// the excerpts may contain a %, so the response is not a format
+	fmt.Fprint(w, encodeJson(&postListResp{jsonResp{true, ""}, posts, next}))
+
+	return nil
+}
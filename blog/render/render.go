@@ -0,0 +1,85 @@
+// Package render turns the markdown of post bodies into html.
+//
+// The markdown is CommonMark with GitHub flavored tables. Raw html in the
+// source is omitted and links of dangerous schemes like javascript: are
+// dropped, so the output can be put into a page as it is.
+//
+// Fenced code blocks are highlighted by the language of the info string.
+// The tokens are marked with css classes rather than inline styles, the
+// stylesheet is written by CSS. A block can turn the line numbers on or off
+// with an attribute after the language:
+//
+//	```go {linenos=true}
+package render
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting"
+	"github.com/yuin/goldmark/extension"
+)
+
+// DefaultStyle is the chroma style of the stylesheet shipped with the blog
+const DefaultStyle = "github"
+
+// Options changes how the markdown is rendered
+type Options struct {
+	// LineNumbers numbers the lines of the code blocks
+	// that have no linenos attribute
+	LineNumbers bool
+}
+
+// Renderer renders markdown with a set of options.
+// It is safe for concurrent use.
+type Renderer struct {
+	md goldmark.Markdown
+}
+
+func New(opts Options) *Renderer {
+	return &Renderer{goldmark.New(
+		goldmark.WithExtensions(
+			extension.NewTable(
+				// align attributes rather than styles, which are sanitized away
+				extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute),
+			),
+			highlighting.NewHighlighting(
+				highlighting.WithFormatOptions(formatOptions(opts)...),
+			),
+		),
+	)}
+}
+
+func formatOptions(opts Options) []html.Option {
+	return []html.Option{
+		html.WithClasses(true),
+		html.WithLineNumbers(opts.LineNumbers),
+		html.LineNumbersInTable(true),
+	}
+}
+
+// Markdown renders the markdown source to html.
+func (r *Renderer) Markdown(src string) (string, error) {
+
+	var buf bytes.Buffer
+	if err := r.md.Convert([]byte(src), &buf); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+var defaultRenderer = New(Options{})
+
+// Markdown renders the markdown source to html with the default options.
+func Markdown(src string) (string, error) {
+	return defaultRenderer.Markdown(src)
+}
+
+// CSS writes the stylesheet of the highlighted code in the named chroma style.
+func CSS(w io.Writer, style string) error {
+	return html.New(formatOptions(Options{})...).WriteCSS(w, styles.Get(style))
+}
@@ -0,0 +1,76 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdown(t *testing.T) {
+	cases := []struct {
+		name    string
+		src     string
+		want    []string
+		notWant []string
+	}{
+		{"Emphasis", "*hi* **there**", []string{"<em>hi</em>", "<strong>there</strong>"}, nil},
+		{"Table", "| a | b |\n|---|---|\n| 1 | 2 |", []string{"<table>", "<th>a</th>", "<td>2</td>"}, nil},
+		{"FencedCode", "```go\nfmt.Println(\"<b>\")\n```",
+			[]string{`<pre tabindex="0" class="chroma">`, `<span class="nf">Println</span>`, "&lt;b&gt;"}, []string{"style="}},
+		{"UnknownLanguage", "```nosuchlang\n<x>\n```", []string{`<pre><code class="language-nosuchlang">&lt;x&gt;`}, nil},
+		{"LineNumbers", "```go {linenos=true}\na := 1\nb := 2\n```", []string{`class="lntable"`, `<span class="lnt">2`}, nil},
+		{"RawHTML", "<script>alert(1)</script>\n\nok <b onclick=\"x()\">b</b>",
+			[]string{"ok"}, []string{"<script", "onclick"}},
+		{"JavascriptURL", "[x](javascript:alert(1))", []string{"<a href=\"\">x</a>"}, []string{"javascript:"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Markdown(tc.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tc.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("want %q in %q", s, got)
+				}
+			}
+			for _, s := range tc.notWant {
+				if strings.Contains(got, s) {
+					t.Errorf("want no %q in %q", s, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLineNumbersOption(t *testing.T) {
+	r := New(Options{LineNumbers: true})
+
+	got, err := r.Markdown("```go\na := 1\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, `class="lntable"`) {
+		t.Errorf("want numbered lines in %q", got)
+	}
+
+	got, err = r.Markdown("```go {linenos=false}\na := 1\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, `class="lnt"`) {
+		t.Errorf("want no numbered lines in %q", got)
+	}
+}
+
+func TestCSS(t *testing.T) {
+	var s strings.Builder
+	if err := CSS(&s, DefaultStyle); err != nil {
+		t.Fatal(err)
+	}
+	for _, class := range []string{".chroma .nf", ".chroma .lnt"} {
+		if !strings.Contains(s.String(), class) {
+			t.Errorf("want %q in the stylesheet", class)
+		}
+	}
+}
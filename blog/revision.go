@@ -0,0 +1,223 @@
+package blog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hzget/goblog/blog/textdiff"
+)
+
+// Revision is the content of a post recorded by one save
+type Revision struct {
+	Id     int64     `json:"id"`
+	PostId int64     `json:"postid"`
+	Author string    `json:"author"`
+	Date   time.Time `json:"date"`
+	Title  string    `json:"title"`
+	Body   string    `json:"body"`
+}
+
+type restoreReq struct {
+	Id       int64 `json:"id"`
+	Revision int64 `json:"revision"`
+}
+
+type diffLine struct {
+	Sign  string
+	Class string
+	Text  string
+}
+
+var diffLineClass = map[textdiff.Op]string{
+	textdiff.Equal:  "",
+	textdiff.Insert: "w3-pale-green",
+	textdiff.Delete: "w3-pale-red",
+}
+
+func getRevision(id int64) (*Revision, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	return revisionStore.GetRevision(ctx, id)
+}
+
+func getRevisions(postid int64) ([]Revision, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	return revisionStore.ListRevisions(ctx, postid)
+}
+
+// getPostRevision returns the revision only if it belongs to the post
+func getPostRevision(postid, id int64) (*Revision, error) {
+
+	r, err := getRevision(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.PostId != postid {
+		return nil, sql.ErrNoRows
+	}
+
+	return r, nil
+}
+
+func historyHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) {
+
+	perm, err := info.getPermisson()
+	if err != nil {
+		handleErr(w, r, err)
+		return
+	}
+
+	if perm&PermView == 0 {
+		printAlert(w, "the user is not allowed to view post history", http.StatusBadRequest)
+		return
+	}
+
+	post, err := loadPost(info.Id)
+	if err != nil {
+		printAlert(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	revisions, err := getRevisions(info.Id)
+	if err != nil {
+		printAlert(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Id        int64
+		Title     string
+		Revisions []Revision
+		CanEdit   bool
+	}{info.Id, post.Title, revisions, perm&PermEdit > 0}
+
+	renderTemplate(w, "history.html", data)
+}
+
+func diffHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) {
+
+	perm, err := info.getPermisson()
+	if err != nil {
+		handleErr(w, r, err)
+		return
+	}
+
+	if perm&PermView == 0 {
+		printAlert(w, "the user is not allowed to view post history", http.StatusBadRequest)
+		return
+	}
+
+	from, err1 := strconv.ParseInt(r.FormValue("from"), 10, 64)
+	to, err2 := strconv.ParseInt(r.FormValue("to"), 10, 64)
+	if err1 != nil || err2 != nil {
+		printAlert(w, "please choose two revisions to compare", http.StatusBadRequest)
+		return
+	}
+
+	var revs [2]*Revision
+	for i, id := range []int64{from, to} {
+		revs[i], err = getPostRevision(info.Id, id)
+		switch {
+		case err == sql.ErrNoRows:
+			printAlert(w, fmt.Sprintf("no revision %d of post %d", id, info.Id),
+				http.StatusBadRequest)
+			return
+		case err != nil:
+			printAlert(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data := struct {
+		Id         int64
+		From, To   *Revision
+		TitleLines []diffLine
+		BodyLines  []diffLine
+	}{
+		info.Id, revs[0], revs[1],
+		getDiffLines(revs[0].Title, revs[1].Title),
+		getDiffLines(revs[0].Body, revs[1].Body),
+	}
+
+	renderTemplate(w, "diff.html", data)
+}
+
+func getDiffLines(a, b string) []diffLine {
+
+	var lines []diffLine
+	for _, l := range textdiff.Lines(a, b) {
+		lines = append(lines, diffLine{
+			Sign:  l.Op.String(),
+			Class: diffLineClass[l.Op],
+			Text:  l.Text,
+		})
+	}
+
+	return lines
+}
+
+// restorejsHandler saves the content of an old revision as the newest one,
+// the history before it is kept.
+func restorejsHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appError {
+
+	var req = &restoreReq{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	if req.Id <= 0 {
+		return &appError{errors.New("invalid post id"), http.StatusBadRequest}
+	}
+
+	info.Id = req.Id
+	perm, err := info.getPermisson()
+	if err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	canEdit := perm&PermEdit > 0
+	if !canEdit {
+		return &appError{errors.New("the user is not allowed to edit and save post"),
+			http.StatusBadRequest}
+	}
+
+	rev, err := getPostRevision(req.Id, req.Revision)
+	switch {
+	case err == sql.ErrNoRows:
+		return &appError{err, http.StatusBadRequest}
+	case err != nil:
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	// a revision keeps the content only, the post keeps its status and format
+	var post = &Post{Id: req.Id, Title: rev.Title, Body: rev.Body, Author: info.Username}
+	if err := post.keepStatus(); err != nil {
+		return &appError{err, http.StatusInternalServerError}
+	}
+	if err := post.keepFormat(); err != nil {
+		return &appError{err, http.StatusInternalServerError}
+	}
+	if err := post.save(); err != nil {
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	fmt.Fprintf(w, encodeJsonSaveResp(true,
+		fmt.Sprintf("revision %d restored", rev.Id), post.Id, post.Version))
+
+	return nil
+}
@@ -0,0 +1,246 @@
+// Package sanitize cleans untrusted html by an allowlist of elements,
+// attributes and url schemes.
+//
+// Elements not in the list are dropped but their text is kept, except for
+// the ones whose content is never text (script, style and the like),
+// which are dropped with their content. Attributes not in the list of
+// their element are dropped, event handlers and style included, and a url
+// attribute is dropped unless it is relative or of an allowed scheme.
+// The output is well formed: every open element is closed.
+package sanitize
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// elements dropped along with their content
+var dropContent = map[string]bool{
+	"script": true, "style": true, "iframe": true, "frame": true,
+	"frameset": true, "object": true, "embed": true, "applet": true,
+	"noscript": true, "noembed": true, "noframes": true, "template": true,
+	"textarea": true, "select": true, "title": true, "xmp": true,
+	"svg": true, "math": true,
+}
+
+// attributes holding a url
+var urlAttrs = map[string]bool{
+	"href": true, "src": true, "cite": true, "action": true,
+	"formaction": true, "poster": true, "background": true,
+}
+
+// void elements have no end tag
+var voidElements = map[string]bool{
+	"area": true, "br": true, "col": true, "hr": true, "img": true,
+	"wbr": true,
+}
+
+// Policy is an allowlist of html. It is built once and then
+// safe for concurrent use.
+type Policy struct {
+	elements map[string]map[string]bool // element -> allowed attributes
+	global   map[string]bool            // attributes allowed on any element
+	schemes  map[string]bool
+	linkRel  string
+}
+
+func NewPolicy() *Policy {
+	return &Policy{
+		elements: map[string]map[string]bool{},
+		global:   map[string]bool{},
+		schemes:  map[string]bool{},
+	}
+}
+
+// AllowElements allows the elements, without attributes.
+func (p *Policy) AllowElements(names ...string) *Policy {
+	for _, name := range names {
+		if p.elements[name] == nil {
+			p.elements[name] = map[string]bool{}
+		}
+	}
+	return p
+}
+
+// AllowAttrs allows the attributes on the element, and the element itself.
+func (p *Policy) AllowAttrs(element string, attrs ...string) *Policy {
+	p.AllowElements(element)
+	for _, a := range attrs {
+		p.elements[element][a] = true
+	}
+	return p
+}
+
+// AllowGlobalAttrs allows the attributes on any allowed element.
+func (p *Policy) AllowGlobalAttrs(attrs ...string) *Policy {
+	for _, a := range attrs {
+		p.global[a] = true
+	}
+	return p
+}
+
+// AllowURLSchemes allows the absolute urls of the schemes,
+// relative urls are always allowed.
+func (p *Policy) AllowURLSchemes(schemes ...string) *Policy {
+	for _, s := range schemes {
+		p.schemes[strings.ToLower(s)] = true
+	}
+	return p
+}
+
+// SetLinkRel sets the rel attribute of the links, e.g. "nofollow ugc".
+func (p *Policy) SetLinkRel(rel string) *Policy {
+	p.linkRel = rel
+	return p
+}
+
+// Sanitize returns the html with everything not allowed removed.
+func (p *Policy) Sanitize(s string) string {
+
+	var out strings.Builder
+	var open []string // allowed elements not closed yet
+	drop := ""        // the element whose content is being dropped
+	depth := 0        // nesting of drop in itself
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// io.EOF, or a text too deeply nested
+			break
+		}
+		t := z.Token()
+
+		if drop != "" {
+			switch {
+			case tt == html.StartTagToken && t.Data == drop:
+				depth++
+			case tt == html.EndTagToken && t.Data == drop:
+				if depth--; depth == 0 {
+					drop = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case html.TextToken:
+			out.WriteString(html.EscapeString(t.Data))
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if dropContent[t.Data] {
+				if tt == html.StartTagToken {
+					drop, depth = t.Data, 1
+				}
+				continue
+			}
+			if _, ok := p.elements[t.Data]; !ok {
+				continue
+			}
+			p.writeStartTag(&out, t)
+			if !voidElements[t.Data] {
+				if tt == html.SelfClosingTagToken {
+					out.WriteString("</" + t.Data + ">")
+				} else {
+					open = append(open, t.Data)
+				}
+			}
+
+		case html.EndTagToken:
+			// close the element and the ones left open in it
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != t.Data {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					out.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+
+		// comments and doctypes are dropped
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i] + ">")
+	}
+
+	return out.String()
+}
+
+func (p *Policy) writeStartTag(out *strings.Builder, t html.Token) {
+
+	out.WriteString("<" + t.Data)
+	seen := map[string]bool{}
+	for _, a := range t.Attr {
+		if a.Namespace != "" || seen[a.Key] {
+			continue
+		}
+		if !p.elements[t.Data][a.Key] && !p.global[a.Key] {
+			continue
+		}
+		if a.Key == "rel" && t.Data == "a" && p.linkRel != "" {
+			continue
+		}
+		if urlAttrs[a.Key] && !p.allowURL(a.Val) {
+			continue
+		}
+		seen[a.Key] = true
+		out.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+	}
+	if t.Data == "a" && p.linkRel != "" {
+		out.WriteString(` rel="` + html.EscapeString(p.linkRel) + `"`)
+	}
+	out.WriteString(">")
+}
+
+// allowURL checks the scheme of a url the way a browser reads it,
+// which ignores whitespace and control characters in it
+func (p *Policy) allowURL(raw string) bool {
+
+	s := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, raw)
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" {
+		// a relative url, but not one a browser may take as a scheme
+		return !strings.Contains(strings.SplitN(s, "/", 2)[0], ":")
+	}
+
+	return p.schemes[strings.ToLower(u.Scheme)]
+}
+
+// Post is the policy of the html rendered from post bodies: the
+// markdown elements with the classes of the highlighted code.
+var Post = NewPolicy().
+	AllowElements("p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6",
+		"blockquote", "pre", "code", "span", "div", "em", "strong", "b", "i",
+		"del", "s", "sub", "sup", "mark", "ul", "li", "dl", "dt", "dd",
+		"table", "thead", "tbody", "tr").
+	AllowAttrs("a", "href", "title").
+	AllowAttrs("img", "src", "alt", "title", "width", "height").
+	AllowAttrs("ol", "start").
+	AllowAttrs("th", "align").
+	AllowAttrs("td", "align").
+	AllowAttrs("pre", "tabindex").
+	AllowGlobalAttrs("class").
+	AllowURLSchemes("http", "https", "mailto")
+
+// Comment is the policy of comments: inline formatting and links,
+// which are marked as user content not endorsed by the blog.
+var Comment = NewPolicy().
+	AllowElements("b", "i", "em", "strong", "code", "del", "s").
+	AllowAttrs("a", "href", "title").
+	AllowURLSchemes("http", "https", "mailto").
+	SetLinkRel("nofollow ugc")
@@ -0,0 +1,63 @@
+package sanitize
+
+import "testing"
+
+func TestSanitize(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"Text", "a < b & c", "a &lt; b &amp; c"},
+		{"Allowed", `<p>hi <em>there</em></p>`, `<p>hi <em>there</em></p>`},
+		{"Script", `<p>x<script>alert("<p>")</script>y</p>`, `<p>xy</p>`},
+		{"NestedSvg", `<svg><svg onload=alert(1)></svg><p>in</p></svg>out`, `out`},
+		{"UnclosedScript", `ok<script>alert(1)`, `ok`},
+		{"Style", `<style>p{color:red}</style><p style="x">p</p>`, `<p>p</p>`},
+		{"UnknownElement", `<blink>kept</blink>`, `kept`},
+		{"EventHandler", `<img src="a.png" onerror="alert(1)" OnLoad=x>`, `<img src="a.png">`},
+		{"EventHandlerSelfClosing", `<img src=x onerror=alert(1) />`, `<img src="x">`},
+		{"JavascriptURL", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"JavascriptURLCase", `<a href="JaVaScRiPt:alert(1)">x</a>`, `<a>x</a>`},
+		{"JavascriptURLEntity", `<a href="&#106;avascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"JavascriptURLWhitespace", "<a href=\" java\tscript:alert(1)\">x</a>", `<a>x</a>`},
+		{"DataURL", `<img src="data:text/html;base64,PHNjcmlwdD4=">`, `<img>`},
+		{"VBScriptURL", `<a href="vbscript:msgbox(1)">x</a>`, `<a>x</a>`},
+		{"HTTPURL", `<a href="https://example.com/?a=1&amp;b=2">x</a>`, `<a href="https://example.com/?a=1&amp;b=2">x</a>`},
+		{"RelativeURL", `<a href="../view/1">x</a>`, `<a href="../view/1">x</a>`},
+		{"AttrBreakout", `<a title='"><script>alert(1)</script>'>x</a>`, `<a title="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;">x</a>`},
+		{"Unclosed", `<p><strong>bold`, `<p><strong>bold</strong></p>`},
+		{"StrayEnd", `</p>text</div>`, `text`},
+		{"Misnested", `<em><strong>x</em>y</strong>`, `<em><strong>x</strong></em>y`},
+		{"Comment", `a<!-- <script>alert(1)</script> -->b`, `ab`},
+		{"CodeClasses", `<pre tabindex="0" class="chroma"><span class="nx">a</span></pre>`,
+			`<pre tabindex="0" class="chroma"><span class="nx">a</span></pre>`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Post.Sanitize(tc.src); got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCommentPolicy(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`<b>bold</b> <p>para</p>`, `<b>bold</b> para`},
+		{`<a href="https://example.com" rel="author" onclick="x()">x</a>`,
+			`<a href="https://example.com" rel="nofollow ugc">x</a>`},
+		{`<a href="javascript:alert(1)">x</a>`, `<a rel="nofollow ugc">x</a>`},
+		{`<img src=x onerror=alert(1)>`, ``},
+	}
+
+	for _, tc := range cases {
+		if got := Comment.Sanitize(tc.src); got != tc.want {
+			t.Errorf("Sanitize(%q): want %q, got %q", tc.src, tc.want, got)
+		}
+	}
+}
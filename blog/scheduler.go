@@ -0,0 +1,51 @@
+package blog
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const scheduleInterval = time.Minute
+
+// runScheduler publishes the scheduled posts whose time has come,
+// once at startup and then every scheduleInterval until ctx is done.
+func runScheduler(ctx context.Context) {
+
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		publishScheduledPosts()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func publishScheduledPosts() {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	ids, err := postStore.PublishScheduled(ctx, time.Now())
+	for _, id := range ids {
+		s := fmt.Sprintf("%d", id)
+		DBRemoveCache(Key_SQL_GetPostInfo + s)
+		DBRemoveCache(Key_SQL_loadPost + s)
+		removePostTagCache(id)
+		if p, err := loadPost(id); err == nil {
+			indexPost(p)
+		} else {
+			Warn("scheduler: fail to index post " + s + ": " + err.Error())
+		}
+		Info("scheduler: post " + s + " is published")
+	}
+
+	if err != nil {
+		Warn("scheduler: fail to publish scheduled posts: " + err.Error())
+	}
+}
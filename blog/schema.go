@@ -0,0 +1,139 @@
+package blog
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/hzget/goblog/blog/migrate"
+	"github.com/spf13/viper"
+)
+
+// numbered migration files, one directory per database dialect.
+// a change of the schema is a new pair of files in both directories,
+// an applied file shall never be edited.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+const migrationTimeout = 5 * time.Minute
+
+func newMigrator() (*migrate.Migrator, error) {
+
+	dialect := "mysql"
+	if sqlitePath != "" {
+		dialect = "sqlite"
+	}
+
+	files, err := fs.Sub(migrationFiles, "migrations/"+dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(db, files)
+}
+
+// initSchema applies the pending migrations if "migration.auto" is set
+// and refuses to serve if the schema is still behind the binary.
+func initSchema() {
+
+	m, err := newMigrator()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	if viper.GetBool("migration.auto") {
+		applied, err := m.Up(ctx)
+		for _, mg := range applied {
+			Info(fmt.Sprintf("migration %d_%s applied", mg.Version, mg.Name))
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	version, err := m.Version(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(pending) > 0 {
+		log.Fatalf("database schema version %d is behind %d, "+
+			"please run \"goblog migrate up\"", version, m.Latest())
+	}
+
+	if version > m.Latest() {
+		Warn(fmt.Sprintf("database schema version %d is ahead of %d",
+			version, m.Latest()))
+	}
+}
+
+// Migrate runs the migration command given by args:
+//
+//	up        apply all pending migrations
+//	down [N]  revert the last N (default 1) migrations
+//	status    print the applied and the latest version
+func Migrate(args []string) error {
+
+	getConfig()
+	initLogging()
+	defer closeLogFile()
+	initDBHandler()
+
+	m, err := newMigrator()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	cmd := "status"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+
+	var done []migrate.Migration
+	switch cmd {
+	case "up":
+		done, err = m.Up(ctx)
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+		}
+		done, err = m.Down(ctx, n)
+	case "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q", cmd)
+	}
+
+	for _, mg := range done {
+		fmt.Printf("%s %d_%s\n", cmd, mg.Version, mg.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version %d, latest %d\n", version, m.Latest())
+
+	return nil
+}
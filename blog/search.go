@@ -0,0 +1,228 @@
+package blog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hzget/goblog/blog/search"
+)
+
+type searchReq struct {
+	Query string `json:"q"`
+	Limit int    `json:"limit"`
+}
+
+// searchResult is a matching post, Title and Snippet are html
+// with the words of the query marked
+type searchResult struct {
+	Id        int64         `json:"id"`
+	Title     template.HTML `json:"title"`
+	Author    string        `json:"author"`
+	PublishAt time.Time     `json:"publishat"`
+	Snippet   template.HTML `json:"snippet"`
+	Score     float64       `json:"score"`
+}
+
+type searchResp struct {
+	jsonResp
+	Results []searchResult `json:"results"`
+}
+
+const (
+	searchLimit    = 20
+	maxSearchLimit = 100
+	snippetWidth   = 240
+)
+
+/* the index holds the published posts only */
+var searchIndex = search.NewIndex()
+
+// initSearchIndex reads the index saved at the last shutdown,
+// or builds it from the database if rebuild is set or there is no such file
+func initSearchIndex(rebuild bool, file string) {
+
+	if !rebuild && file != "" {
+		err := loadSearchIndex(file)
+		if err == nil {
+			return
+		}
+		Warn(fmt.Sprintf("fail to load search index %s: %v, rebuild it", file, err))
+	}
+
+	if err := rebuildSearchIndex(); err != nil {
+		Warn("fail to build the search index: " + err.Error())
+	}
+}
+
+func loadSearchIndex(file string) error {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	x, err := search.Load(f)
+	if err != nil {
+		return err
+	}
+	searchIndex = x
+	Info(fmt.Sprintf("search index loaded with %d posts", x.Len()))
+
+	return nil
+}
+
+func rebuildSearchIndex() error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbStartupTime)
+	defer cancel()
+
+	ps, err := postStore.ListPostsInfo(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	x := search.NewIndex()
+	for _, p := range ps {
+		if p.Status == StatusPublished {
+			x.Add(p.Id, p.Title, p.Body)
+		}
+	}
+	searchIndex = x
+	Info(fmt.Sprintf("search index built with %d posts", x.Len()))
+
+	return nil
+}
+
+func saveSearchIndex(file string) {
+
+	if file == "" {
+		return
+	}
+
+	f, err := os.Create(file)
+	if err == nil {
+		err = searchIndex.Save(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	if err != nil {
+		Warn(fmt.Sprintf("fail to save search index %s: %v", file, err))
+	}
+}
+
+// indexPost keeps the index up to date with a saved post
+func indexPost(p *Post) {
+	if p.Status == StatusPublished {
+		searchIndex.Add(p.Id, p.Title, p.Body)
+		return
+	}
+	searchIndex.Remove(p.Id)
+}
+
+func searchPosts(query string, limit int) ([]searchResult, error) {
+
+	results := []searchResult{}
+	for _, hit := range searchIndex.Search(query, limit) {
+		p, err := getPostInfo(hit.Id)
+		if err == sql.ErrNoRows {
+			// the post is gone, the index lags behind
+			searchIndex.Remove(hit.Id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// the index may lag behind a change of status
+		if p.Status != StatusPublished {
+			continue
+		}
+
+		results = append(results, searchResult{
+			Id:        p.Id,
+			Title:     highlight(p.Title, query, 0),
+			Author:    p.Author,
+			PublishAt: p.PublishAt,
+			Snippet:   highlight(p.Body, query, snippetWidth),
+			Score:     hit.Score,
+		})
+	}
+
+	return results, nil
+}
+
+// highlight escapes the text and marks the words of the query
+func highlight(text, query string, width int) template.HTML {
+
+	var s strings.Builder
+	for _, f := range search.Highlight(text, query, width) {
+		if f.Match {
+			s.WriteString("<mark>" + getHTMLEscapeString(f.Text) + "</mark>")
+		} else {
+			s.WriteString(getHTMLEscapeString(f.Text))
+		}
+	}
+
+	return template.HTML(s.String())
+}
+
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+
+	query := strings.TrimSpace(r.FormValue("q"))
+
+	var results []searchResult
+	if query != "" {
+		var err error
+		if results, err = searchPosts(query, searchLimit); err != nil {
+			printAlert(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data := struct {
+		Query   string
+		Results []searchResult
+	}{query, results}
+
+	renderTemplate(w, "search.html", data)
+}
+
+func searchjsHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appError {
+
+	var req = &searchReq{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		return &appError{errors.New("the query is empty"), http.StatusBadRequest}
+	}
+
+	if req.Limit <= 0 || req.Limit > maxSearchLimit {
+		req.Limit = searchLimit
+	}
+
+	results, err := searchPosts(req.Query, req.Limit)
+	if err != nil {
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	// the snippets may contain a %, so the response is not a format
+	fmt.Fprint(w, encodeJson(&searchResp{jsonResp{true, ""}, results}))
+
+	return nil
+}
@@ -0,0 +1,321 @@
+// Package search is an in-memory full-text index of documents with a
+// title and a body, ranked by BM25.
+package search
+
+import (
+	"encoding/gob"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BM25 parameters, and the weight of a title word against a body word
+const (
+	k1          = 1.2
+	b           = 0.75
+	titleWeight = 3
+)
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "in": true, "is": true,
+	"it": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "with": true,
+}
+
+// Token is a word of a text and its byte offsets in the text
+type Token struct {
+	Word       string
+	Start, End int
+}
+
+// Tokenize splits the text into lowercase words of letters and digits.
+func Tokenize(text string) []Token {
+
+	var toks []Token
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			toks = append(toks, Token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		toks = append(toks, Token{strings.ToLower(text[start:]), start, len(text)})
+	}
+
+	return toks
+}
+
+// Terms returns the stems of the words of the text that are indexed
+func Terms(text string) []string {
+
+	var terms []string
+	for _, t := range Tokenize(text) {
+		if stopWords[t.Word] {
+			continue
+		}
+		terms = append(terms, Stem(t.Word))
+	}
+
+	return terms
+}
+
+// Hit is a document matching a query
+type Hit struct {
+	Id    int64
+	Score float64
+}
+
+// Index maps the terms to the documents containing them.
+// It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[int64]map[string]int // id -> term -> weighted frequency
+	lens     map[int64]int
+	postings map[string]map[int64]int // term -> id -> weighted frequency
+	total    int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     map[int64]map[string]int{},
+		lens:     map[int64]int{},
+		postings: map[string]map[int64]int{},
+	}
+}
+
+// Add indexes the document, replacing the one with the same id.
+func (x *Index) Add(id int64, title, body string) {
+
+	tf := map[string]int{}
+	for _, t := range Terms(title) {
+		tf[t] += titleWeight
+	}
+	for _, t := range Terms(body) {
+		tf[t]++
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(id)
+	x.add(id, tf)
+}
+
+// Remove drops the document from the index.
+func (x *Index) Remove(id int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(id)
+}
+
+// Len returns the number of documents in the index.
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return len(x.docs)
+}
+
+func (x *Index) add(id int64, tf map[string]int) {
+	n := 0
+	for t, f := range tf {
+		if x.postings[t] == nil {
+			x.postings[t] = map[int64]int{}
+		}
+		x.postings[t][id] = f
+		n += f
+	}
+	x.docs[id], x.lens[id] = tf, n
+	x.total += n
+}
+
+func (x *Index) remove(id int64) {
+	tf, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	for t := range tf {
+		delete(x.postings[t], id)
+		if len(x.postings[t]) == 0 {
+			delete(x.postings, t)
+		}
+	}
+	x.total -= x.lens[id]
+	delete(x.docs, id)
+	delete(x.lens, id)
+}
+
+// Search returns at most limit documents matching any term of the query,
+// the best first. Documents of the same score are ordered by id, newest first.
+func (x *Index) Search(query string, limit int) []Hit {
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if len(x.docs) == 0 {
+		return nil
+	}
+
+	n := float64(len(x.docs))
+	avg := float64(x.total) / n
+	scores := map[int64]float64{}
+	for t := range termSet(query) {
+		ids := x.postings[t]
+		idf := math.Log(1 + (n-float64(len(ids))+0.5)/(float64(len(ids))+0.5))
+		for id, f := range ids {
+			tf := float64(f)
+			norm := k1 * (1 - b + b*float64(x.lens[id])/avg)
+			scores[id] += idf * tf * (k1 + 1) / (tf + norm)
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, s := range scores {
+		hits = append(hits, Hit{id, s})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Id > hits[j].Id
+	})
+
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	return hits
+}
+
+func termSet(query string) map[string]bool {
+	set := map[string]bool{}
+	for _, t := range Terms(query) {
+		set[t] = true
+	}
+	return set
+}
+
+// Save writes the index to w, it can be read back by Load.
+func (x *Index) Save(w io.Writer) error {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return gob.NewEncoder(w).Encode(x.docs)
+}
+
+// Load reads an index written by Save.
+func Load(r io.Reader) (*Index, error) {
+
+	var docs map[int64]map[string]int
+	if err := gob.NewDecoder(r).Decode(&docs); err != nil {
+		return nil, err
+	}
+
+	x := NewIndex()
+	for id, tf := range docs {
+		x.add(id, tf)
+	}
+
+	return x, nil
+}
+
+// Fragment is a piece of a text, Match is set if it is a word of the query.
+type Fragment struct {
+	Text  string
+	Match bool
+}
+
+// Highlight splits the text into fragments marking the words of the query.
+// If width > 0 and the text is longer than width bytes, only a snippet of
+// about width bytes around the first matching word is kept and "…" marks
+// the text cut off.
+func Highlight(text, query string, width int) []Fragment {
+
+	terms := termSet(query)
+	toks := Tokenize(text)
+
+	start, end := 0, len(text)
+	if width > 0 && len(text) > width {
+		first := -1
+		for _, t := range toks {
+			if terms[Stem(t.Word)] {
+				first = t.Start
+				break
+			}
+		}
+
+		// keep some context in front of the first match
+		if first > width/4 {
+			start = wordStart(toks, first-width/4)
+		}
+		end = start + width
+		if end < len(text) {
+			end = wordEnd(toks, text, start, end)
+		} else {
+			end = len(text)
+		}
+	}
+
+	var frags []Fragment
+	if start > 0 {
+		frags = append(frags, Fragment{Text: "…"})
+	}
+
+	pos := start
+	for _, t := range toks {
+		if t.Start < start || t.End > end {
+			continue
+		}
+		if !terms[Stem(t.Word)] {
+			continue
+		}
+		if t.Start > pos {
+			frags = append(frags, Fragment{Text: text[pos:t.Start]})
+		}
+		frags = append(frags, Fragment{Text: text[t.Start:t.End], Match: true})
+		pos = t.End
+	}
+	if end > pos {
+		frags = append(frags, Fragment{Text: text[pos:end]})
+	}
+
+	if end < len(text) {
+		frags = append(frags, Fragment{Text: "…"})
+	}
+
+	return frags
+}
+
+// wordStart returns the start of the first word at or after pos
+func wordStart(toks []Token, pos int) int {
+	for _, t := range toks {
+		if t.Start >= pos {
+			return t.Start
+		}
+	}
+	return pos
+}
+
+// wordEnd moves end back so that no word or character is cut in half
+func wordEnd(toks []Token, text string, start, end int) int {
+	for _, t := range toks {
+		if t.Start < end && end < t.End && t.Start > start {
+			return t.Start
+		}
+	}
+	for end > start && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return end
+}
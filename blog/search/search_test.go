@@ -0,0 +1,92 @@
+package search
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Go's élan, 2x")
+	want := []Token{{"go", 0, 2}, {"s", 3, 4}, {"élan", 5, 10}, {"2x", 12, 14}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func newTestIndex() *Index {
+	x := NewIndex()
+	x.Add(1, "Goroutines", "a goroutine is a lightweight thread managed by the go runtime")
+	x.Add(2, "Channels", "channels connect concurrent goroutines")
+	x.Add(3, "Cooking", "how to cook rice in a pot")
+	return x
+}
+
+func TestSearch(t *testing.T) {
+	x := newTestIndex()
+
+	hits := x.Search("goroutine", 0)
+	if len(hits) != 2 || hits[0].Id != 1 || hits[1].Id != 2 {
+		t.Fatalf("want the title match first, got %v", hits)
+	}
+
+	if hits := x.Search("the", 0); len(hits) != 0 {
+		t.Fatalf("want no hit for a stop word, got %v", hits)
+	}
+
+	if hits := x.Search("cooked rice", 1); len(hits) != 1 || hits[0].Id != 3 {
+		t.Fatalf("want the stemmed match, got %v", hits)
+	}
+
+	x.Add(3, "Cooking", "boil water")
+	if hits := x.Search("rice", 0); len(hits) != 0 {
+		t.Fatalf("want no hit after the document is replaced, got %v", hits)
+	}
+
+	x.Remove(1)
+	if hits := x.Search("goroutine", 0); len(hits) != 1 || hits[0].Id != 2 {
+		t.Fatalf("want only document 2 after removing 1, got %v", hits)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	x := newTestIndex()
+
+	var buf bytes.Buffer
+	if err := x.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	y, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if y.Len() != x.Len() || !reflect.DeepEqual(y.Search("goroutines", 0), x.Search("goroutines", 0)) {
+		t.Fatalf("want the same index after a reload")
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := Highlight("Channels connect goroutines", "connected", 0)
+	want := []Fragment{{"Channels ", false}, {"connect", true}, {" goroutines", false}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	text := strings.Repeat("lorem ipsum ", 20) + "goroutine " + strings.Repeat("dolor sit ", 20)
+	frags := Highlight(text, "goroutine", 60)
+	var s strings.Builder
+	for _, f := range frags {
+		if f.Match {
+			s.WriteString("[" + f.Text + "]")
+		} else {
+			s.WriteString(f.Text)
+		}
+	}
+	snippet := s.String()
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") ||
+		!strings.Contains(snippet, "[goroutine]") || len(snippet) > 60+len("……[]") {
+		t.Fatalf("want a cut snippet around the match, got %q", snippet)
+	}
+}
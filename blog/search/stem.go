@@ -0,0 +1,258 @@
+package search
+
+// Stem reduces an english word in lowercase to its stem with the
+// Porter stemming algorithm, e.g. "connections" and "connected" both
+// become "connect". Words of other letters than a-z are kept as they are.
+func Stem(word string) string {
+
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+
+	z := &stemmer{b: []byte(word), k: len(word) - 1}
+	z.step1ab()
+	if z.k > 0 {
+		z.step1c()
+		z.step2()
+		z.step3()
+		z.step4()
+		z.step5()
+	}
+
+	return string(z.b[:z.k+1])
+}
+
+// stemmer keeps the word in b[0:k+1]; j marks the end of the stem
+// in front of a suffix found by ends.
+type stemmer struct {
+	b    []byte
+	k, j int
+}
+
+// cons reports whether b[i] is a consonant
+func (z *stemmer) cons(i int) bool {
+	switch z.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !z.cons(i-1)
+	}
+	return true
+}
+
+// m measures the number of vowel-consonant sequences in b[0:j+1]
+func (z *stemmer) m() int {
+	n, i := 0, 0
+	for ; i <= z.j && z.cons(i); i++ {
+	}
+	for i <= z.j {
+		for ; i <= z.j && !z.cons(i); i++ {
+		}
+		if i > z.j {
+			break
+		}
+		n++
+		for ; i <= z.j && z.cons(i); i++ {
+		}
+	}
+	return n
+}
+
+// vowelinstem reports whether b[0:j+1] contains a vowel
+func (z *stemmer) vowelinstem() bool {
+	for i := 0; i <= z.j; i++ {
+		if !z.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doublec reports whether b[i-1:i+1] is a double consonant
+func (z *stemmer) doublec(i int) bool {
+	return i >= 1 && z.b[i] == z.b[i-1] && z.cons(i)
+}
+
+// cvc reports whether b[i-2:i+1] is consonant-vowel-consonant and the
+// last one is not w, x or y, as in "hop" but not in "snow" or "box"
+func (z *stemmer) cvc(i int) bool {
+	if i < 2 || !z.cons(i) || z.cons(i-1) || !z.cons(i-2) {
+		return false
+	}
+	switch z.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends reports whether the word ends with s and sets j in front of it
+func (z *stemmer) ends(s string) bool {
+	l := len(s)
+	if l > z.k+1 || string(z.b[z.k-l+1:z.k+1]) != s {
+		return false
+	}
+	z.j = z.k - l
+	return true
+}
+
+// setto replaces the suffix after j with s
+func (z *stemmer) setto(s string) {
+	z.b = append(z.b[:z.j+1], s...)
+	z.k = z.j + len(s)
+}
+
+func (z *stemmer) r(s string) {
+	if z.m() > 0 {
+		z.setto(s)
+	}
+}
+
+// replace applies the first pair of suffix and replacement that matches
+func (z *stemmer) replace(pairs ...string) {
+	for i := 0; i < len(pairs); i += 2 {
+		if z.ends(pairs[i]) {
+			z.r(pairs[i+1])
+			return
+		}
+	}
+}
+
+// step1ab removes plurals and -ed or -ing
+func (z *stemmer) step1ab() {
+	if z.b[z.k] == 's' {
+		switch {
+		case z.ends("sses"):
+			z.k -= 2
+		case z.ends("ies"):
+			z.setto("i")
+		case z.b[z.k-1] != 's':
+			z.k--
+		}
+	}
+
+	if z.ends("eed") {
+		if z.m() > 0 {
+			z.k--
+		}
+		return
+	}
+
+	if (z.ends("ed") || z.ends("ing")) && z.vowelinstem() {
+		z.k = z.j
+		switch {
+		case z.ends("at"):
+			z.setto("ate")
+		case z.ends("bl"):
+			z.setto("ble")
+		case z.ends("iz"):
+			z.setto("ize")
+		case z.doublec(z.k):
+			switch z.b[z.k-1] {
+			case 'l', 's', 'z':
+			default:
+				z.k--
+			}
+		default:
+			z.j = z.k
+			if z.m() == 1 && z.cvc(z.k) {
+				z.setto("e")
+			}
+		}
+	}
+}
+
+// step1c turns a terminal y to i when there is another vowel in the stem
+func (z *stemmer) step1c() {
+	if z.ends("y") && z.vowelinstem() {
+		z.b[z.k] = 'i'
+	}
+}
+
+// step2 maps double suffixes to single ones, e.g. -ization to -ize
+func (z *stemmer) step2() {
+	switch z.b[z.k-1] {
+	case 'a':
+		z.replace("ational", "ate", "tional", "tion")
+	case 'c':
+		z.replace("enci", "ence", "anci", "ance")
+	case 'e':
+		z.replace("izer", "ize")
+	case 'l':
+		z.replace("bli", "ble", "alli", "al", "entli", "ent", "eli", "e", "ousli", "ous")
+	case 'o':
+		z.replace("ization", "ize", "ation", "ate", "ator", "ate")
+	case 's':
+		z.replace("alism", "al", "iveness", "ive", "fulness", "ful", "ousness", "ous")
+	case 't':
+		z.replace("aliti", "al", "iviti", "ive", "biliti", "ble")
+	case 'g':
+		z.replace("logi", "log")
+	}
+}
+
+// step3 deals with -ic-, -full, -ness etc.
+func (z *stemmer) step3() {
+	switch z.b[z.k] {
+	case 'e':
+		z.replace("icate", "ic", "ative", "", "alize", "al")
+	case 'i':
+		z.replace("iciti", "ic")
+	case 'l':
+		z.replace("ical", "ic", "ful", "")
+	case 's':
+		z.replace("ness", "")
+	}
+}
+
+var step4Suffixes = map[byte][]string{
+	'a': {"al"},
+	'c': {"ance", "ence"},
+	'e': {"er"},
+	'i': {"ic"},
+	'l': {"able", "ible"},
+	'n': {"ant", "ement", "ment", "ent"},
+	's': {"ism"},
+	't': {"ate", "iti"},
+	'u': {"ous"},
+	'v': {"ive"},
+	'z': {"ize"},
+}
+
+// step4 takes off -ant, -ence etc. in the context <c>vcvc<v>
+func (z *stemmer) step4() {
+	found := false
+	if z.b[z.k-1] == 'o' {
+		found = z.ends("ion") && z.j >= 0 && (z.b[z.j] == 's' || z.b[z.j] == 't') ||
+			z.ends("ou")
+	} else {
+		for _, s := range step4Suffixes[z.b[z.k-1]] {
+			if found = z.ends(s); found {
+				break
+			}
+		}
+	}
+
+	if found && z.m() > 1 {
+		z.k = z.j
+	}
+}
+
+// step5 removes a final -e and changes -ll to -l when m() > 1
+func (z *stemmer) step5() {
+	z.j = z.k
+	if z.b[z.k] == 'e' {
+		a := z.m()
+		if a > 1 || a == 1 && !z.cvc(z.k-1) {
+			z.k--
+		}
+	}
+	if z.b[z.k] == 'l' && z.doublec(z.k) && z.m() > 1 {
+		z.k--
+	}
+}
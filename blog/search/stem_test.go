@@ -0,0 +1,38 @@
+package search
+
+import "testing"
+
+func TestStem(t *testing.T) {
+	cases := map[string]string{
+		"caresses":       "caress",
+		"ponies":         "poni",
+		"cats":           "cat",
+		"feed":           "feed",
+		"agreed":         "agre",
+		"plastered":      "plaster",
+		"motoring":       "motor",
+		"sing":           "sing",
+		"conflated":      "conflat",
+		"troubled":       "troubl",
+		"sized":          "size",
+		"hopping":        "hop",
+		"falling":        "fall",
+		"filing":         "file",
+		"happy":          "happi",
+		"relational":     "relat",
+		"rational":       "ration",
+		"generalization": "gener",
+		"running":        "run",
+		"connections":    "connect",
+		"connected":      "connect",
+		"go":             "go",
+		"2023":           "2023",
+		"café":           "café",
+	}
+
+	for word, want := range cases {
+		if got := Stem(word); got != want {
+			t.Errorf("Stem(%q): want %q, got %q", word, want, got)
+		}
+	}
+}
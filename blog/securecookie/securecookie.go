@@ -0,0 +1,166 @@
+// Package securecookie signs, and optionally encrypts, the values of
+// cookies so that a client can neither forge nor change them.
+//
+// An encoded value is
+//
+//	<key id>.<payload>.<mac>
+//
+// where the payload is the value, or the AES-GCM sealed value when
+// encrypting, and the mac is the HMAC-SHA256 of the cookie name, the key
+// id and the payload. Both are base64url encoded. The first key signs,
+// all of them verify, so a key is rotated by putting a new one first and
+// dropping the old one once the cookies it signed have expired.
+package securecookie
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MinSecretLen is the length a secret shall have at least
+const MinSecretLen = 32
+
+var (
+	// ErrInvalid is returned for a value that was not encoded by a codec
+	// with the same keys, or was changed since
+	ErrInvalid = errors.New("securecookie: invalid value")
+	// ErrUnknownKey is returned for a value signed by a key that is gone
+	ErrUnknownKey = errors.New("securecookie: unknown key")
+)
+
+var b64 = base64.RawURLEncoding
+
+// Key is a secret with the id that tells which one signed a value
+type Key struct {
+	Id     string
+	Secret []byte
+}
+
+type key struct {
+	id   string
+	mac  []byte
+	aead cipher.AEAD
+}
+
+// Codec encodes and decodes the values of cookies
+type Codec struct {
+	keys    []key
+	encrypt bool
+}
+
+// New returns a codec signing with the first key. The values are
+// encrypted too if encrypt is set.
+func New(keys []Key, encrypt bool) (*Codec, error) {
+
+	if len(keys) == 0 {
+		return nil, errors.New("securecookie: no keys")
+	}
+
+	c := &Codec{encrypt: encrypt}
+	seen := map[string]bool{}
+	for _, k := range keys {
+		switch {
+		case k.Id == "" || strings.Contains(k.Id, "."):
+			return nil, fmt.Errorf("securecookie: invalid key id %q", k.Id)
+		case seen[k.Id]:
+			return nil, fmt.Errorf("securecookie: duplicate key id %q", k.Id)
+		case len(k.Secret) < MinSecretLen:
+			return nil, fmt.Errorf("securecookie: the secret of key %q is shorter than %d bytes",
+				k.Id, MinSecretLen)
+		}
+		seen[k.Id] = true
+
+		// the keys to sign and to encrypt are derived from the secret,
+		// neither is used for both
+		block, err := aes.NewCipher(derive(k.Secret, "encrypt"))
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.keys = append(c.keys, key{k.Id, derive(k.Secret, "sign"), aead})
+	}
+
+	return c, nil
+}
+
+func derive(secret []byte, purpose string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte("securecookie " + purpose))
+	return h.Sum(nil)
+}
+
+func (k *key) sum(name, payload string) []byte {
+	h := hmac.New(sha256.New, k.mac)
+	h.Write([]byte(name + "|" + k.id + "|" + payload))
+	return h.Sum(nil)
+}
+
+// Encode returns the value of the cookie with the name
+func (c *Codec) Encode(name string, value []byte) (string, error) {
+
+	k := &c.keys[0]
+	if c.encrypt {
+		nonce := make([]byte, k.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		value = k.aead.Seal(nonce, nonce, value, []byte(name))
+	}
+
+	payload := b64.EncodeToString(value)
+
+	return k.id + "." + payload + "." + b64.EncodeToString(k.sum(name, payload)), nil
+}
+
+// Decode verifies the value of the cookie with the name and returns what
+// was encoded. Stale tells that it was signed by a key other than the
+// first one, the cookie is to be encoded again.
+func (c *Codec) Decode(name, encoded string) (value []byte, stale bool, err error) {
+
+	parts := strings.Split(encoded, ".")
+	if len(parts) != 3 {
+		return nil, false, ErrInvalid
+	}
+
+	var k *key
+	for i := range c.keys {
+		if c.keys[i].id == parts[0] {
+			k, stale = &c.keys[i], i > 0
+			break
+		}
+	}
+	if k == nil {
+		return nil, false, ErrUnknownKey
+	}
+
+	mac, err := b64.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(mac, k.sum(name, parts[1])) {
+		return nil, false, ErrInvalid
+	}
+
+	if value, err = b64.DecodeString(parts[1]); err != nil {
+		return nil, false, ErrInvalid
+	}
+
+	if c.encrypt {
+		n := k.aead.NonceSize()
+		if len(value) < n {
+			return nil, false, ErrInvalid
+		}
+		if value, err = k.aead.Open(nil, value[:n], value[n:], []byte(name)); err != nil {
+			return nil, false, ErrInvalid
+		}
+	}
+
+	return value, stale, nil
+}
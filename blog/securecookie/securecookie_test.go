@@ -0,0 +1,98 @@
+package securecookie
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var (
+	k1 = Key{"k1", bytes.Repeat([]byte("a"), MinSecretLen)}
+	k2 = Key{"k2", bytes.Repeat([]byte("b"), MinSecretLen)}
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		c, err := New([]Key{k1}, encrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v, err := c.Encode("session", []byte(`{"user":"bob"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plain := b64.EncodeToString([]byte(`{"user":"bob"}`)); strings.Contains(v, plain) == encrypt {
+			t.Fatalf("encrypt %v: got %s", encrypt, v)
+		}
+
+		got, stale, err := c.Decode("session", v)
+		if err != nil || stale || string(got) != `{"user":"bob"}` {
+			t.Fatalf("encrypt %v: want the value, got %q, %v, %v", encrypt, got, stale, err)
+		}
+	}
+}
+
+func TestTampered(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		c, _ := New([]Key{k1}, encrypt)
+		v, _ := c.Encode("session", []byte("bob"))
+		parts := strings.Split(v, ".")
+
+		other, _ := c.Encode("session", []byte("amy"))
+		forged := parts[0] + "." + strings.Split(other, ".")[1] + "." + parts[2]
+
+		for name, bad := range map[string]string{
+			"empty":       "",
+			"plain":       "bob",
+			"payload":     forged,
+			"mac":         v[:len(v)-2] + "AA",
+			"no mac":      parts[0] + "." + parts[1],
+			"extra parts": v + ".x",
+		} {
+			if _, _, err := c.Decode("session", bad); err != ErrInvalid {
+				t.Errorf("%s: want ErrInvalid, got %v", name, err)
+			}
+		}
+
+		// a value is bound to the name of its cookie
+		if _, _, err := c.Decode("user", v); err != ErrInvalid {
+			t.Errorf("other name: want ErrInvalid, got %v", err)
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old, _ := New([]Key{k1}, false)
+	v, _ := old.Encode("session", []byte("bob"))
+
+	rotated, _ := New([]Key{k2, k1}, false)
+	got, stale, err := rotated.Decode("session", v)
+	if err != nil || !stale || string(got) != "bob" {
+		t.Fatalf("want the value of the old key and stale, got %q, %v, %v", got, stale, err)
+	}
+
+	nv, _ := rotated.Encode("session", got)
+	if !strings.HasPrefix(nv, "k2.") {
+		t.Fatalf("want the value signed by the first key, got %s", nv)
+	}
+
+	dropped, _ := New([]Key{k2}, false)
+	if _, _, err := dropped.Decode("session", v); err != ErrUnknownKey {
+		t.Fatalf("want ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for name, keys := range map[string][]Key{
+		"no keys":      nil,
+		"short secret": {{"k", []byte("short")}},
+		"no id":        {{"", k1.Secret}},
+		"dot in id":    {{"k.1", k1.Secret}},
+		"duplicate id": {k1, {"k1", k2.Secret}},
+	} {
+		if _, err := New(keys, false); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package blog
+
+/*
+ * sessions: a user signs in on many devices at once, each of them with
+ * a session of its own
+ *
+ *     session:#token    hash of the session: user, agent, ip, created, seen
+ *     sessions:#user    set of the tokens of the user
+ *
+ * Both expire with the session, the set with the newest one. A token in
+ * the set may be of a session gone already, it is dropped when the set
+ * is read.
+ *
+ * The pages show a session by its Ref, a hash of the token, so that
+ * the tokens of the other devices never leave the server.
+ */
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	sessionPrefix      = "session:"
+	userSessionsPrefix = "sessions:"
+	// the last seen time of a session is written at most this often
+	sessionSeenInterval = time.Minute
+	maxSessionAgentLen  = 256
+)
+
+// Session is a device signed in by a user, its Id is the token of the cookie
+type Session struct {
+	Id       string    `json:"-"`
+	Ref      string    `json:"id"`
+	User     string    `json:"user"`
+	Agent    string    `json:"agent"`
+	IP       string    `json:"ip"`
+	Created  time.Time `json:"created"`
+	LastSeen time.Time `json:"lastseen"`
+}
+
+// touchScript sets the last seen time of a session only if it is still
+// there, a hash set after it expired would never expire
+var touchScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("HSET", KEYS[1], "seen", ARGV[1])
+end
+return 0
+`)
+
+func sessionKey(token string) string {
+	return sessionPrefix + token
+}
+
+func userSessionsKey(user string) string {
+	return userSessionsPrefix + user
+}
+
+// sessionRef names the session of the token without giving the token away
+func sessionRef(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// remoteIP is the address the request comes from
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// newSession signs the user in on the device of the request
+func newSession(r *http.Request, user string) (*Session, error) {
+
+	now := time.Now()
+	agent := r.UserAgent()
+	if len(agent) > maxSessionAgentLen {
+		agent = agent[:maxSessionAgentLen]
+	}
+	token := uuid.NewString()
+	s := &Session{Id: token, Ref: sessionRef(token), User: user, Agent: agent,
+		IP: remoteIP(r), Created: now, LastSeen: now}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	key, set := sessionKey(s.Id), userSessionsKey(user)
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, map[string]interface{}{
+		"user":    s.User,
+		"agent":   s.Agent,
+		"ip":      s.IP,
+		"created": s.Created.Format(time.RFC3339Nano),
+		"seen":    s.LastSeen.Format(time.RFC3339Nano),
+	})
+	pipe.Expire(ctx, key, sessionTimeout)
+	pipe.SAdd(ctx, set, s.Id)
+	pipe.Expire(ctx, set, sessionTimeout)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// loadSession returns the session of the token, redis.Nil if there is none
+func loadSession(token string) (*Session, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	m, err := rdb.HGetAll(ctx, sessionKey(token)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if m["user"] == "" {
+		return nil, redis.Nil
+	}
+
+	s := &Session{Id: token, Ref: sessionRef(token), User: m["user"],
+		Agent: m["agent"], IP: m["ip"]}
+	s.Created, _ = time.Parse(time.RFC3339Nano, m["created"])
+	s.LastSeen, _ = time.Parse(time.RFC3339Nano, m["seen"])
+
+	return s, nil
+}
+
+// touchSession records that the session is in use
+func touchSession(s *Session) error {
+
+	now := time.Now()
+	if now.Sub(s.LastSeen) < sessionSeenInterval {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	err := touchScript.Run(ctx, rdb, []string{sessionKey(s.Id)}, now.Format(time.RFC3339Nano)).Err()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	s.LastSeen = now
+
+	return nil
+}
+
+// deleteSession signs the device of the session out
+func deleteSession(s *Session) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, sessionKey(s.Id))
+	pipe.SRem(ctx, userSessionsKey(s.User), s.Id)
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// userSessions returns the sessions of the user, the last seen first.
+// The tokens of the sessions gone are dropped from the set.
+func userSessions(user string) ([]*Session, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	tokens, err := rdb.SMembers(ctx, userSessionsKey(user)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var ss []*Session
+	var gone []interface{}
+	for _, token := range tokens {
+		s, err := loadSession(token)
+		switch {
+		case err == redis.Nil || err == nil && s.User != user:
+			gone = append(gone, token)
+		case err != nil:
+			return nil, err
+		default:
+			ss = append(ss, s)
+		}
+	}
+
+	if len(gone) > 0 {
+		if err := rdb.SRem(ctx, userSessionsKey(user), gone...).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(ss, func(i, j int) bool { return ss[i].LastSeen.After(ss[j].LastSeen) })
+
+	return ss, nil
+}
+
+// deleteUserSessions signs the user out on all the devices
+func deleteUserSessions(user string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	set := userSessionsKey(user)
+	tokens, err := rdb.SMembers(ctx, set).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{set}
+	for _, token := range tokens {
+		keys = append(keys, sessionKey(token))
+	}
+
+	return rdb.Del(ctx, keys...).Err()
+}
+
+// currentSession returns the session of the cookie of the request. The
+// cookie is signed again if w is given and it was signed by a rotated key.
+func currentSession(w http.ResponseWriter, r *http.Request) (*Session, error) {
+
+	claims, stale, err := sessionToken(r)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := loadSession(claims.Token)
+	switch {
+	case err == redis.Nil:
+		return nil, NewRespErr(err, http.StatusUnauthorized)
+	case err != nil:
+		return nil, NewRespErr(err, http.StatusInternalServerError)
+	case s.User != claims.User:
+		return nil, NewRespErr(ErrSessionCookie, http.StatusUnauthorized)
+	}
+
+	if err := touchSession(s); err != nil {
+		Warn("fail to touch session of " + s.User + ": " + err.Error())
+	}
+
+	if stale && w != nil {
+		if err := setSessionCookies(w, s); err != nil {
+			Warn("fail to renew the cookies of " + s.User + ": " + err.Error())
+		}
+	}
+
+	return s, nil
+}
+
+// isCurrentSession tells whether s is the session of the request
+func isCurrentSession(r *http.Request, s *Session) bool {
+	claims, _, err := sessionToken(r)
+	return err == nil && claims.Token == s.Id
+}
+
+// revokeSession signs out the session of the user with the ref,
+// sql.ErrNoRows if the user has none
+func revokeSession(user, ref string) (*Session, error) {
+
+	ss, err := userSessions(user)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range ss {
+		if s.Ref == ref {
+			return s, deleteSession(s)
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+type sessionInfo struct {
+	*Session
+	Current bool `json:"current"`
+}
+
+type sessionsResp struct {
+	jsonResp
+	Sessions []sessionInfo `json:"sessions"`
+}
+
+type revokeSessionReq struct {
+	// the Ref of the session, all the sessions of the user if empty
+	Id   string `json:"id"`
+	User string `json:"user"`
+}
+
+// sessionInfos marks the session of the request among the ones of the user
+func sessionInfos(r *http.Request, user string) ([]sessionInfo, error) {
+
+	ss, err := userSessions(user)
+	if err != nil {
+		return nil, err
+	}
+
+	var current string
+	if claims, _, err := sessionToken(r); err == nil {
+		current = claims.Token
+	}
+
+	infos := []sessionInfo{}
+	for _, s := range ss {
+		infos = append(infos, sessionInfo{s, s.Id == current})
+	}
+
+	return infos, nil
+}
+
+func renderSessions(w http.ResponseWriter, r *http.Request, user string, admin bool) {
+
+	infos, err := sessionInfos(r, user)
+	if err != nil {
+		printAlert(w, fmt.Sprintf("get sessions failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		User     string
+		Admin    bool
+		Sessions []sessionInfo
+	}{user, admin, infos}
+
+	renderTemplate(w, "sessions.html", data)
+}
+
+// sessionsHandler shows the user where they are signed in
+func sessionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	username, err := ValidateSession(w, r)
+	if err != nil {
+		RespondAlert(w, err)
+		return
+	}
+
+	renderSessions(w, r, username, false)
+}
+
+func sessionsjsHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appError {
+
+	infos, err := sessionInfos(r, info.Username)
+	if err != nil {
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	fmt.Fprint(w, encodeJson(&sessionsResp{jsonResp{true, ""}, infos}))
+
+	return nil
+}
+
+// revokesessionjsHandler signs out one session of the user, or all of
+// them if no id is given. The cookies are cleared if the device of the
+// request is signed out too.
+func revokesessionjsHandler(w http.ResponseWriter, r *http.Request, info *PageInfo) *appError {
+
+	var req = &revokeSessionReq{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return &appError{err, http.StatusBadRequest}
+	}
+
+	if req.User != "" && req.User != info.Username {
+		return &appError{errors.New("only the sessions of your own can be revoked"),
+			http.StatusForbidden}
+	}
+
+	if req.Id == "" {
+		if err := deleteUserSessions(info.Username); err != nil {
+			return &appError{err, http.StatusInternalServerError}
+		}
+		clearCookies(w)
+		fmt.Fprint(w, encodeJsonResp(true, "signed out everywhere"))
+		return nil
+	}
+
+	s, err := revokeSession(info.Username, req.Id)
+	switch {
+	case err == sql.ErrNoRows:
+		return &appError{fmt.Errorf("no session %s", req.Id), http.StatusBadRequest}
+	case err != nil:
+		return &appError{err, http.StatusInternalServerError}
+	}
+
+	if isCurrentSession(r, s) {
+		clearCookies(w)
+	}
+	fmt.Fprint(w, encodeJsonResp(true, "session revoked"))
+
+	return nil
+}
+
+// usersessionsHandler shows the admin where a user is signed in
+func usersessionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := r.FormValue("user")
+	if exist, err := checkUserExist(user); err != nil {
+		printAlert(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !exist {
+		printAlert(w, fmt.Sprintf("no such user %q", user), http.StatusBadRequest)
+		return
+	}
+
+	renderSessions(w, r, user, true)
+}
+
+// adminrevokejsHandler forces a user to sign out of one session,
+// or of all of them if no id is given
+func adminrevokejsHandler(w http.ResponseWriter, r *http.Request) {
+
+	var req = &revokeSessionReq{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil || req.User == "" {
+		http.Error(w, encodeJsonResp(false, "a user is required"), http.StatusBadRequest)
+		return
+	}
+
+	if req.Id == "" {
+		if err := deleteUserSessions(req.User); err != nil {
+			fmt.Printf("internal error %v\n", err)
+			http.Error(w, encodeJsonResp(false, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		Info(fmt.Sprintf("all the sessions of %s are revoked", req.User))
+		fmt.Fprint(w, encodeJsonResp(true, "user signed out everywhere"))
+		return
+	}
+
+	_, err := revokeSession(req.User, req.Id)
+	switch {
+	case err == sql.ErrNoRows:
+		http.Error(w, encodeJsonResp(false, fmt.Sprintf("no session %s of %s", req.Id, req.User)),
+			http.StatusBadRequest)
+		return
+	case err != nil:
+		fmt.Printf("internal error %v\n", err)
+		http.Error(w, encodeJsonResp(false, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	Info(fmt.Sprintf("session %s of %s is revoked", req.Id, req.User))
+	fmt.Fprint(w, encodeJsonResp(true, "session revoked"))
+}
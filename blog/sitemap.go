@@ -0,0 +1,201 @@
+package blog
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// the most urls a sitemap may have by the protocol,
+	// more are split into sitemaps listed by a sitemap index
+	sitemapMaxURLs = 50000
+	// crawlers fetch the map now and then, it may be a little stale
+	sitemapMaxAge = 3600
+)
+
+/* set up by the config */
+var robotsDisallow []string
+var robotsExtra string
+
+// the paths no crawler should visit, under the site prefix
+var robotsPrivate = []string{"/edit/", "/superadmin", "/code/"}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// sitemapParts returns the number of sitemaps of n urls, 0 if they fit
+// in a single sitemap and no index is needed
+func sitemapParts(n int) int {
+	if n <= sitemapMaxURLs {
+		return 0
+	}
+	return (n + sitemapMaxURLs - 1) / sitemapMaxURLs
+}
+
+func countPublishedPosts() (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	return postStore.CountPublishedPosts(ctx)
+}
+
+// sitemapPosts returns the urls of a part of the published posts,
+// the part is 0-based
+func sitemapPosts(base string, part int) ([]sitemapURL, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	ps, err := postStore.ListPublishedPosts(ctx, part*sitemapMaxURLs, sitemapMaxURLs)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]sitemapURL, len(ps))
+	for i, p := range ps {
+		urls[i] = sitemapURL{
+			Loc:     base + "/view/" + strconv.FormatInt(p.Id, 10),
+			LastMod: p.Modified.UTC().Format(time.RFC3339),
+		}
+	}
+
+	return urls, nil
+}
+
+func writeSitemap(w http.ResponseWriter, v interface{}) {
+
+	b, err := xml.MarshalIndent(v, "", "\t")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", sitemapMaxAge))
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+}
+
+// sitemapHandler serves /sitemap.xml, the urls of the published posts.
+// Beyond sitemapMaxURLs of them it is an index of /sitemap/#n.xml,
+// each of sitemapMaxURLs posts but the last.
+func sitemapHandler(w http.ResponseWriter, r *http.Request) {
+
+	base := siteBase()
+	if base == "" {
+		noSiteBase(w)
+		return
+	}
+
+	n, err := countPublishedPosts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	parts := sitemapParts(n)
+	if parts == 0 {
+		urls, err := sitemapPosts(base, 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeSitemap(w, &sitemapURLSet{URLs: urls})
+		return
+	}
+
+	index := &sitemapIndex{}
+	for i := 1; i <= parts; i++ {
+		index.Sitemaps = append(index.Sitemaps,
+			sitemapURL{Loc: fmt.Sprintf("%s/sitemap/%d.xml", base, i)})
+	}
+	writeSitemap(w, index)
+}
+
+// sitemapPartHandler serves a sitemap of the index, /sitemap/#n.xml
+func sitemapPartHandler(w http.ResponseWriter, r *http.Request) {
+
+	base := siteBase()
+	if base == "" {
+		noSiteBase(w)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, sitePrefix+"/sitemap/")
+	part, err := strconv.Atoi(strings.TrimSuffix(name, ".xml"))
+	if err != nil || !strings.HasSuffix(name, ".xml") || part < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	n, err := countPublishedPosts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if part > sitemapParts(n) {
+		http.NotFound(w, r)
+		return
+	}
+
+	urls, err := sitemapPosts(base, part-1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeSitemap(w, &sitemapURLSet{URLs: urls})
+}
+
+// robotsTxt keeps the crawlers out of the private pages and points them
+// to the sitemap. A random site prefix is a secret, so it is written as
+// a wildcard and the sitemap is left out, as it is without page.url.
+func robotsTxt(base string) string {
+
+	prefix := sitePrefix
+	if randomSitePrefix {
+		prefix = "/*"
+	}
+
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	for _, p := range robotsPrivate {
+		fmt.Fprintf(&b, "Disallow: %s%s\n", prefix, p)
+	}
+	for _, p := range robotsDisallow {
+		fmt.Fprintf(&b, "Disallow: %s\n", p)
+	}
+	if !randomSitePrefix && base != "" {
+		fmt.Fprintf(&b, "\nSitemap: %s/sitemap.xml\n", base)
+	}
+	if robotsExtra != "" {
+		b.WriteString("\n" + strings.TrimSpace(robotsExtra) + "\n")
+	}
+
+	return b.String()
+}
+
+// robotsHandler serves /robots.txt at the root of the host, where the
+// crawlers look for it whatever the site prefix is
+func robotsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", sitemapMaxAge))
+	fmt.Fprint(w, robotsTxt(siteBase()))
+}
@@ -0,0 +1,99 @@
+// Package spam tells spam texts from the others with a naive Bayes
+// classifier learned from labelled examples.
+package spam
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	ham = iota
+	spam
+)
+
+// NaiveBayes is a multinomial naive Bayes classifier over the words
+// of the texts. It is safe for concurrent use.
+type NaiveBayes struct {
+	mu    sync.RWMutex
+	docs  [2]int64
+	total [2]int64
+	words [2]map[string]int64
+	vocab map[string]bool
+}
+
+func NewNaiveBayes() *NaiveBayes {
+	return &NaiveBayes{
+		words: [2]map[string]int64{{}, {}},
+		vocab: map[string]bool{},
+	}
+}
+
+// Train learns that the text is spam or not.
+func (nb *NaiveBayes) Train(text string, isSpam bool) {
+
+	class := ham
+	if isSpam {
+		class = spam
+	}
+
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+
+	nb.docs[class]++
+	for _, w := range Tokenize(text) {
+		nb.words[class][w]++
+		nb.total[class]++
+		nb.vocab[w] = true
+	}
+}
+
+// SpamProb returns the probability in [0, 1] that the text is spam.
+// It is 0.5 until both spam and other texts have been learned.
+func (nb *NaiveBayes) SpamProb(text string) float64 {
+
+	nb.mu.RLock()
+	defer nb.mu.RUnlock()
+
+	if nb.docs[ham] == 0 || nb.docs[spam] == 0 {
+		return 0.5
+	}
+
+	// log P(class) + sum of log P(word|class) with laplace smoothing
+	var score [2]float64
+	v := float64(len(nb.vocab))
+	for class := range score {
+		score[class] = math.Log(float64(nb.docs[class]) /
+			float64(nb.docs[ham]+nb.docs[spam]))
+		for _, w := range Tokenize(text) {
+			if !nb.vocab[w] {
+				continue
+			}
+			score[class] += math.Log(float64(nb.words[class][w]+1) /
+				(float64(nb.total[class]) + v))
+		}
+	}
+
+	return 1 / (1 + math.Exp(score[ham]-score[spam]))
+}
+
+// Tokenize splits the text into lowercase words of letters and digits,
+// the ones shorter than 2 or longer than 32 characters are dropped.
+func Tokenize(text string) []string {
+
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	words := fields[:0]
+	for _, f := range fields {
+		if n := utf8.RuneCountInString(f); n >= 2 && n <= 32 {
+			words = append(words, f)
+		}
+	}
+
+	return words
+}
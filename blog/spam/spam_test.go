@@ -0,0 +1,46 @@
+package spam
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Buy CHEAP pills at http://x.example, a 100% deal!")
+	want := []string{"buy", "cheap", "pills", "at", "http", "example", "100", "deal"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func TestNaiveBayes(t *testing.T) {
+	nb := NewNaiveBayes()
+	if p := nb.SpamProb("buy cheap pills"); p != 0.5 {
+		t.Fatalf("want 0.5 before training, got %v", p)
+	}
+
+	for _, s := range []string{
+		"buy cheap pills online now",
+		"cheap casino bonus, click the link now",
+		"win money now, visit my casino site",
+	} {
+		nb.Train(s, true)
+	}
+	for _, s := range []string{
+		"nice post, the goroutine example helped me",
+		"I think the second example has a typo in the loop",
+		"thanks for the explanation of the scheduler",
+	} {
+		nb.Train(s, false)
+	}
+
+	if p := nb.SpamProb("cheap pills and casino bonus now"); p < 0.9 {
+		t.Fatalf("want a spam probability above 0.9, got %v", p)
+	}
+	if p := nb.SpamProb("the example of the scheduler helped"); p > 0.1 {
+		t.Fatalf("want a spam probability below 0.1, got %v", p)
+	}
+	if p := nb.SpamProb("unknown words only"); p != 0.5 {
+		t.Fatalf("want 0.5 for unknown words with balanced classes, got %v", p)
+	}
+}
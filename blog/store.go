@@ -0,0 +1,167 @@
+package blog
+
+/*
+ * data store:
+ *
+ *     handlers <-- --> data structure object <-- PostStore/UserStore/... --> mysql/sqlite
+ *
+ * The handlers never touch a database connection directly. They go through
+ * the package level stores below, so another backend can be plugged in (or
+ * a fake one in tests) by assigning a different implementation.
+ *
+ * A store returns sql.ErrNoRows when the requested row does not exist,
+ * because the handlers map that error to http.StatusBadRequest.
+ */
+
+import (
+	"context"
+	"time"
+)
+
+// PostStore keeps posts and reads them back together with their statistics.
+type PostStore interface {
+	// LoadPost returns the post with the given id and its tags.
+	LoadPost(ctx context.Context, id int64) (*Post, error)
+	// InsertPost creates a new post and sets p.Id to the generated id
+	// and p.Version to 1.
+	InsertPost(ctx context.Context, p *Post) error
+	// UpdatePost overwrites title, body, status, publish time, format
+	// and mtime of the post p.Id and
+	// sets p.Version to the new version. If p.Version is not 0 and the
+	// stored version differs, it returns ErrVersionConflict.
+	UpdatePost(ctx context.Context, p *Post) error
+	// SavePost inserts the post if p.Id is 0 and updates it otherwise,
+	// records r as a revision of it and replaces its tags unless p.Tags
+	// is nil, all in one transaction. It returns the tags the post had.
+	SavePost(ctx context.Context, p *Post, r *Revision) ([]string, error)
+	// DeletePost removes the post together with its votes, revisions, tags,
+	// comments and attachments. The blobs of the attachments are left
+	// to the caller.
+	DeletePost(ctx context.Context, id int64) error
+	// GetPostInfo returns the post with its tags and vote statistics.
+	GetPostInfo(ctx context.Context, id int64) (PostInfo, error)
+	// ListPostsInfo returns the published posts and all the posts of
+	// the viewer with their vote statistics.
+	ListPostsInfo(ctx context.Context, viewer string) ([]PostInfo, error)
+	// ListPostSummaries returns a page of the posts selected by q.
+	ListPostSummaries(ctx context.Context, q *PostListQuery) ([]PostSummary, error)
+	// PublishScheduled publishes the scheduled posts whose publish time
+	// is not after now and returns their ids.
+	PublishScheduled(ctx context.Context, now time.Time) ([]int64, error)
+	// ListPostIds returns the ids of all the posts in any status by id.
+	ListPostIds(ctx context.Context) ([]int64, error)
+	// ListAuthors returns the distinct authors ordered by name.
+	ListAuthors(ctx context.Context) ([]string, error)
+	// CountPublishedPosts returns the number of the published posts.
+	CountPublishedPosts(ctx context.Context) (int, error)
+	// ListPublishedPosts returns the ids and mtimes of the published
+	// posts ordered by id, skipping the first offset of them.
+	ListPublishedPosts(ctx context.Context, offset, limit int) ([]PostStamp, error)
+}
+
+// UserStore keeps the registered users, their password hash and rank.
+type UserStore interface {
+	CreateUser(ctx context.Context, username, hash, rank string) error
+	RemoveUser(ctx context.Context, username string) error
+	UserExists(ctx context.Context, username string) (bool, error)
+	// GetPassword returns the password hash of the user.
+	GetPassword(ctx context.Context, username string) (string, error)
+	GetUserInfo(ctx context.Context, username string) (*UserInfo, error)
+	ListUsersInfo(ctx context.Context) ([]UserInfo, error)
+	// UpdateRanks updates the ranks of the given users in one transaction.
+	UpdateRanks(ctx context.Context, infos []UserInfo) error
+}
+
+// VoteStore keeps the star votes of each post.
+type VoteStore interface {
+	// AddVote adds one vote of star (1-5) to the post.
+	AddVote(ctx context.Context, postid int64, star int) error
+	// SetVotes replaces the number of votes of each star of the post.
+	SetVotes(ctx context.Context, postid int64, star [5]int64) error
+}
+
+// RevisionStore keeps the immutable revisions recorded by each save of a post.
+type RevisionStore interface {
+	// AddRevision records a new revision and sets r.Id to the generated id.
+	AddRevision(ctx context.Context, r *Revision) error
+	GetRevision(ctx context.Context, id int64) (*Revision, error)
+	// ListRevisions returns the revisions of a post, newest first,
+	// without their body.
+	ListRevisions(ctx context.Context, postid int64) ([]Revision, error)
+}
+
+// TagStore keeps the tags of the posts, a post has many tags
+// and a tag is shared by many posts.
+type TagStore interface {
+	// SetPostTags replaces the tags of the post.
+	SetPostTags(ctx context.Context, postid int64, tags []string) error
+	GetPostTags(ctx context.Context, postid int64) ([]string, error)
+	// ListTagPosts returns the published posts with the tag, newest first.
+	ListTagPosts(ctx context.Context, tag string) ([]Post, error)
+	// TagCounts returns the number of published posts of each tag.
+	TagCounts(ctx context.Context) ([]TagCount, error)
+}
+
+// CommentStore keeps the comments of the posts. A comment replies to
+// the post itself (parent id 0) or to another comment of the same post.
+type CommentStore interface {
+	// AddComment creates a new comment and sets c.Id to the generated id.
+	AddComment(ctx context.Context, c *Comment) error
+	GetComment(ctx context.Context, id int64) (*Comment, error)
+	// ListComments returns the comments of a post, oldest first.
+	ListComments(ctx context.Context, postid int64) ([]Comment, error)
+	// UpdateComment overwrites the body, status and mtime of the comment c.Id.
+	UpdateComment(ctx context.Context, c *Comment) error
+	// DeleteComment marks the comment as deleted and clears its body,
+	// so that its replies keep their place in the thread.
+	DeleteComment(ctx context.Context, id int64) error
+	// ListCommentsByStatus returns the comments in the status, oldest first.
+	ListCommentsByStatus(ctx context.Context, status string) ([]Comment, error)
+	// ListModeratedComments returns the comments decided by a moderator.
+	ListModeratedComments(ctx context.Context) ([]Comment, error)
+	// ModerateComment sets the status of a pending comment and records
+	// the moderator. It returns sql.ErrNoRows if no such comment is pending.
+	ModerateComment(ctx context.Context, id int64, status, moderator string) error
+}
+
+// AttachmentStore keeps the metadata of the files uploaded to the posts,
+// their content is kept in a blob.Store by key.
+type AttachmentStore interface {
+	// AddAttachment creates a new attachment and sets a.Id to the generated id.
+	AddAttachment(ctx context.Context, a *Attachment) error
+	GetAttachment(ctx context.Context, id int64) (*Attachment, error)
+	GetAttachmentByKey(ctx context.Context, key string) (*Attachment, error)
+	// ListAttachments returns the attachments of a post, newest first.
+	ListAttachments(ctx context.Context, postid int64) ([]Attachment, error)
+	DeleteAttachment(ctx context.Context, id int64) error
+}
+
+// store is implemented by a backend that provides all the stores
+type store interface {
+	PostStore
+	UserStore
+	VoteStore
+	RevisionStore
+	TagStore
+	CommentStore
+	AttachmentStore
+}
+
+/* not thread-safe: assigned once during initialization */
+var postStore PostStore
+var userStore UserStore
+var voteStore VoteStore
+var revisionStore RevisionStore
+var tagStore TagStore
+var commentStore CommentStore
+var attachmentStore AttachmentStore
+
+func initStores() {
+	var s store = newMysqlStore(db)
+	if sqlitePath != "" {
+		s = newSqliteStore(db)
+	}
+
+	postStore, userStore, voteStore, revisionStore = s, s, s, s
+	tagStore, commentStore, attachmentStore = s, s, s
+}
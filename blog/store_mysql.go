@@ -0,0 +1,980 @@
+package blog
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// mysqlStore implements all the stores on top of mysql.
+type mysqlStore struct {
+	db *sql.DB
+}
+
+func newMysqlStore(db *sql.DB) *mysqlStore {
+	return &mysqlStore{db: db}
+}
+
+// querier runs the statements on the database or in a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// nullTime keeps a zero time as NULL, like the publish time of a draft
+// never published
+type nullTime struct {
+	t *time.Time
+}
+
+func (n nullTime) Scan(v interface{}) error {
+	var nt sql.NullTime
+	if err := nt.Scan(v); err != nil {
+		return err
+	}
+	*n.t = nt.Time
+	return nil
+}
+
+func (n nullTime) Value() (driver.Value, error) {
+	if n.t.IsZero() {
+		return nil, nil
+	}
+	return *n.t, nil
+}
+
+func postFields(p *Post) []interface{} {
+	return []interface{}{&p.Id, &p.Title, &p.Author, &p.Date, &p.Modified,
+		&p.Body, &p.Version, &p.Status, nullTime{&p.PublishAt}, &p.Format}
+}
+
+func postInfoFields(p *PostInfo) []interface{} {
+	return append(postFields(&p.Post),
+		&p.Star[0], &p.Star[1], &p.Star[2], &p.Star[3], &p.Star[4])
+}
+
+func (s *mysqlStore) LoadPost(ctx context.Context, id int64) (*Post, error) {
+
+	var p Post
+	row := s.db.QueryRowContext(ctx, Key_SQL_loadPost+`?`, id)
+	err := row.Scan(postFields(&p)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Tags, err = s.GetPostTags(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (s *mysqlStore) InsertPost(ctx context.Context, p *Post) error {
+	return insertPostTx(ctx, s.db, p)
+}
+
+func insertPostTx(ctx context.Context, db querier, p *Post) error {
+
+	q := "INSERT INTO post (title, author, ctime, mtime, body, status, publish_at, format) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := db.ExecContext(ctx, q, p.Title, p.Author, p.Date, p.Modified, p.Body,
+		p.Status, nullTime{&p.PublishAt}, p.Format)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	p.Id, p.Version = id, 1
+
+	return nil
+}
+
+func (s *mysqlStore) UpdatePost(ctx context.Context, p *Post) error {
+	return updatePostTx(ctx, s.db, p)
+}
+
+func updatePostTx(ctx context.Context, db querier, p *Post) error {
+
+	q := "UPDATE post set title = ?, body = ?, mtime = ?, status = ?, publish_at = ?, " +
+		"format = ?, version = version + 1 where id = ?"
+	args := []interface{}{p.Title, p.Body, p.Modified, p.Status, nullTime{&p.PublishAt}, p.Format, p.Id}
+	if p.Version > 0 {
+		q += " and version = ?"
+		args = append(args, p.Version)
+	}
+
+	result, err := db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		if p.Version > 0 {
+			return ErrVersionConflict
+		}
+		return sql.ErrNoRows
+	}
+
+	q = `SELECT version FROM post WHERE id = ?`
+	return db.QueryRowContext(ctx, q, p.Id).Scan(&p.Version)
+}
+
+func (s *mysqlStore) SavePost(ctx context.Context, p *Post, r *Revision) ([]string, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if p.Id == 0 {
+		err = insertPostTx(ctx, tx, p)
+	} else {
+		err = updatePostTx(ctx, tx, p)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.PostId = p.Id
+	if err := addRevisionTx(ctx, tx, r); err != nil {
+		return nil, err
+	}
+
+	old, err := getPostTagsTx(ctx, tx, p.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Tags != nil {
+		if err := setPostTagsTx(ctx, tx, p.Id, p.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	return old, tx.Commit()
+}
+
+func (s *mysqlStore) DeletePost(ctx context.Context, id int64) error {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post WHERE id = ?`, id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM poststatistics WHERE postid = ?`, id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM postrevision WHERE postid = ?`, id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM posttag WHERE postid = ?`, id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM comment WHERE postid = ?`, id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM attachment WHERE postid = ?`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *mysqlStore) GetPostInfo(ctx context.Context, id int64) (PostInfo, error) {
+
+	var p PostInfo
+	row := s.db.QueryRowContext(ctx, Key_SQL_GetPostInfo+"?", id)
+	if err := row.Scan(postInfoFields(&p)...); err != nil {
+		return p, err
+	}
+
+	var err error
+	p.Tags, err = s.GetPostTags(ctx, id)
+
+	return p, err
+}
+
+func (s *mysqlStore) ListPostsInfo(ctx context.Context, viewer string) ([]PostInfo, error) {
+
+	var ps []PostInfo
+	q := `SELECT ` + postColumns + `, ` +
+		`IFNULL(poststatistics.star1,0), ` +
+		`IFNULL(poststatistics.star2,0), ` +
+		`IFNULL(poststatistics.star3,0), ` +
+		`IFNULL(poststatistics.star4,0), ` +
+		`IFNULL(poststatistics.star5,0)  ` +
+		`FROM post ` +
+		`LEFT JOIN poststatistics ` +
+		`ON post.id = poststatistics.postid ` +
+		`WHERE post.status = ? OR post.author = ?`
+
+	rows, err := s.db.QueryContext(ctx, q, StatusPublished, viewer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var p PostInfo
+		if err := rows.Scan(postInfoFields(&p)...); err != nil {
+			return nil, err
+		}
+
+		ps = append(ps, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+const (
+	voteCountExpr = `IFNULL(poststatistics.star1 + poststatistics.star2 + ` +
+		`poststatistics.star3 + poststatistics.star4 + poststatistics.star5, 0)`
+	starAvgExpr = `IFNULL(ROUND((poststatistics.star1 + 2*poststatistics.star2 + ` +
+		`3*poststatistics.star3 + 4*poststatistics.star4 + 5*poststatistics.star5) * 1.0 / ` +
+		`NULLIF(` + voteCountExpr + `, 0), 4), 0)`
+	excerptLen = 200
+)
+
+var postSortExprs = map[string]string{
+	SortCtime:     `post.ctime`,
+	SortMtime:     `post.mtime`,
+	SortPublished: `post.publish_at`,
+	SortStars:     starAvgExpr,
+	SortVotes:     voteCountExpr,
+}
+
+func (s *mysqlStore) ListPostSummaries(ctx context.Context, q *PostListQuery) ([]PostSummary, error) {
+
+	key, ok := postSortExprs[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort key %q", q.Sort)
+	}
+
+	query := `SELECT post.id, post.title, post.author, post.ctime, post.mtime, ` +
+		`post.status, post.publish_at, SUBSTR(post.body, 1, ` +
+		fmt.Sprintf("%d", excerptLen) + `), ` + voteCountExpr + `, ` + starAvgExpr + ` ` +
+		`FROM post ` +
+		`LEFT JOIN poststatistics ` +
+		`ON post.id = poststatistics.postid ` +
+		`WHERE (post.status = ? OR post.author = ?)`
+	args := []interface{}{StatusPublished, q.Viewer}
+
+	if q.Author != "" {
+		query += ` AND post.author = ?`
+		args = append(args, q.Author)
+	}
+
+	cmp, order := `<`, `DESC`
+	if q.Asc {
+		cmp, order = `>`, `ASC`
+	}
+
+	// keyset pagination: continue after the last post of the previous page
+	if q.AfterId > 0 {
+		query += ` AND (` + key + ` ` + cmp + ` ? OR (` + key + ` = ? AND post.id ` + cmp + ` ?))`
+		args = append(args, q.AfterKey, q.AfterKey, q.AfterId)
+	}
+
+	query += ` ORDER BY ` + key + ` ` + order + `, post.id ` + order + ` LIMIT ?`
+	args = append(args, q.Limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ps []PostSummary
+	for rows.Next() {
+		var p PostSummary
+		if err := rows.Scan(&p.Id, &p.Title, &p.Author, &p.Date, &p.Modified,
+			&p.Status, nullTime{&p.PublishAt}, &p.Excerpt, &p.Votes, &p.Stars); err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+func (s *mysqlStore) PublishScheduled(ctx context.Context, now time.Time) ([]int64, error) {
+
+	q := `SELECT id FROM post WHERE status = ? AND publish_at <= ?`
+	rows, err := s.db.QueryContext(ctx, q, StatusScheduled, now)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var due []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		due = append(due, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows.Close()
+
+	// the author may have changed the post in between
+	var ids []int64
+	q = `UPDATE post SET status = ?, version = version + 1 ` +
+		`WHERE id = ? AND status = ? AND publish_at <= ?`
+	for _, id := range due {
+		result, err := s.db.ExecContext(ctx, q, StatusPublished, id, StatusScheduled, now)
+		if err != nil {
+			return ids, err
+		}
+		if n, err := result.RowsAffected(); err == nil && n > 0 {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+func (s *mysqlStore) ListPostIds(ctx context.Context) ([]int64, error) {
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM post ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (s *mysqlStore) ListAuthors(ctx context.Context) ([]string, error) {
+
+	var info []string
+	q := `SELECT DISTINCT author FROM post ORDER BY author`
+
+	rows, err := s.db.QueryContext(ctx, q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var a string
+		if err := rows.Scan(&a); err != nil {
+			return nil, err
+		}
+
+		info = append(info, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (s *mysqlStore) CountPublishedPosts(ctx context.Context) (int, error) {
+
+	var n int
+	q := `SELECT COUNT(*) FROM post WHERE status = ?`
+	if err := s.db.QueryRowContext(ctx, q, StatusPublished).Scan(&n); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (s *mysqlStore) ListPublishedPosts(ctx context.Context, offset, limit int) ([]PostStamp, error) {
+
+	q := `SELECT id, mtime FROM post WHERE status = ? ORDER BY id LIMIT ? OFFSET ?`
+	rows, err := s.db.QueryContext(ctx, q, StatusPublished, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ps []PostStamp
+	for rows.Next() {
+		var p PostStamp
+		if err := rows.Scan(&p.Id, &p.Modified); err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+func (s *mysqlStore) CreateUser(ctx context.Context, username, hash, rank string) error {
+
+	q := "INSERT INTO users (username, password, `rank`) VALUES (?, ?, ?)"
+	_, err := s.db.ExecContext(ctx, q, username, hash, rank)
+
+	return err
+}
+
+func (s *mysqlStore) RemoveUser(ctx context.Context, username string) error {
+
+	q := "DELETE FROM users where username = ?"
+	_, err := s.db.ExecContext(ctx, q, username)
+
+	return err
+}
+
+func (s *mysqlStore) UserExists(ctx context.Context, username string) (bool, error) {
+
+	var exist = false
+	q := `SELECT (count(*)>0) from users WHERE username = ?`
+	err := s.db.QueryRowContext(ctx, q, username).Scan(&exist)
+
+	return exist, err
+}
+
+func (s *mysqlStore) GetPassword(ctx context.Context, username string) (string, error) {
+
+	var password string
+	q := `SELECT password FROM users WHERE username = ?`
+	err := s.db.QueryRowContext(ctx, q, username).Scan(&password)
+
+	return password, err
+}
+
+func (s *mysqlStore) GetUserInfo(ctx context.Context, username string) (*UserInfo, error) {
+
+	info := &UserInfo{Username: username}
+	q := "select `rank` from users where username = ?"
+	err := s.db.QueryRowContext(ctx, q, username).Scan(&info.Rank)
+
+	return info, err
+}
+
+func (s *mysqlStore) ListUsersInfo(ctx context.Context) ([]UserInfo, error) {
+
+	var infos []UserInfo
+	q := "select username, `rank` from users"
+
+	rows, err := s.db.QueryContext(ctx, q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var info UserInfo
+		if err := rows.Scan(&info.Username, &info.Rank); err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, info)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return infos, nil
+}
+
+func (s *mysqlStore) UpdateRanks(ctx context.Context, infos []UserInfo) error {
+
+	// Get a Tx for making transaction requests.
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := "UPDATE users SET `rank` = ? WHERE username = ?"
+	for _, info := range infos {
+		if _, err = tx.ExecContext(ctx, q, info.Rank, info.Username); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *mysqlStore) AddVote(ctx context.Context, postid int64, star int) error {
+
+	if star < 1 || star > 5 {
+		return fmt.Errorf("invalid star %d", star)
+	}
+
+	c := fmt.Sprintf("star%d", star)
+	q := `INSERT INTO poststatistics (postid,` + c + `) VALUES (?, 1)` +
+		` ON DUPLICATE KEY UPDATE ` + c + `=` + c + `+1`
+	_, err := s.db.ExecContext(ctx, q, postid)
+
+	return err
+}
+
+func (s *mysqlStore) SetVotes(ctx context.Context, postid int64, star [5]int64) error {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM poststatistics WHERE postid = ?`, postid); err != nil {
+		return err
+	}
+
+	q := `INSERT INTO poststatistics (postid, star1, star2, star3, star4, star5) ` +
+		`VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := tx.ExecContext(ctx, q, postid, star[0], star[1], star[2], star[3], star[4]); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *mysqlStore) AddRevision(ctx context.Context, r *Revision) error {
+	return addRevisionTx(ctx, s.db, r)
+}
+
+func addRevisionTx(ctx context.Context, db querier, r *Revision) error {
+
+	q := "INSERT INTO postrevision (postid, author, ctime, title, body) VALUES (?, ?, ?, ?, ?)"
+	result, err := db.ExecContext(ctx, q, r.PostId, r.Author, r.Date, r.Title, r.Body)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	r.Id = id
+
+	return nil
+}
+
+func (s *mysqlStore) GetRevision(ctx context.Context, id int64) (*Revision, error) {
+
+	var r Revision
+	q := `SELECT id, postid, author, ctime, title, body FROM postrevision WHERE id = ?`
+	err := s.db.QueryRowContext(ctx, q, id).Scan(
+		&r.Id, &r.PostId, &r.Author, &r.Date, &r.Title, &r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (s *mysqlStore) ListRevisions(ctx context.Context, postid int64) ([]Revision, error) {
+
+	var rs []Revision
+	q := `SELECT id, postid, author, ctime, title FROM postrevision ` +
+		`WHERE postid = ? ORDER BY id DESC`
+
+	rows, err := s.db.QueryContext(ctx, q, postid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var r Revision
+		if err := rows.Scan(&r.Id, &r.PostId, &r.Author, &r.Date, &r.Title); err != nil {
+			return nil, err
+		}
+
+		rs = append(rs, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+func (s *mysqlStore) SetPostTags(ctx context.Context, postid int64, tags []string) error {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setPostTagsTx(ctx, tx, postid, tags); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setPostTagsTx(ctx context.Context, db querier, postid int64, tags []string) error {
+
+	if _, err := db.ExecContext(ctx, `DELETE FROM posttag WHERE postid = ?`, postid); err != nil {
+		return err
+	}
+
+	for _, name := range tags {
+		var tagid int64
+		err := db.QueryRowContext(ctx, `SELECT id FROM tag WHERE name = ?`, name).Scan(&tagid)
+		if err == sql.ErrNoRows {
+			var result sql.Result
+			result, err = db.ExecContext(ctx, `INSERT INTO tag (name) VALUES (?)`, name)
+			if err == nil {
+				tagid, err = result.LastInsertId()
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		q := `INSERT INTO posttag (postid, tagid) VALUES (?, ?)`
+		if _, err := db.ExecContext(ctx, q, postid, tagid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *mysqlStore) GetPostTags(ctx context.Context, postid int64) ([]string, error) {
+	return getPostTagsTx(ctx, s.db, postid)
+}
+
+func getPostTagsTx(ctx context.Context, db querier, postid int64) ([]string, error) {
+
+	q := `SELECT tag.name FROM tag JOIN posttag ON tag.id = posttag.tagid ` +
+		`WHERE posttag.postid = ? ORDER BY tag.name`
+
+	rows, err := db.QueryContext(ctx, q, postid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func (s *mysqlStore) ListTagPosts(ctx context.Context, tag string) ([]Post, error) {
+
+	var ps []Post
+	q := Key_SQL_ListTagPosts + `? ORDER BY post.publish_at DESC`
+
+	rows, err := s.db.QueryContext(ctx, q, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Post
+		if err := rows.Scan(postFields(&p)...); err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+func (s *mysqlStore) TagCounts(ctx context.Context) ([]TagCount, error) {
+
+	var counts []TagCount
+
+	rows, err := s.db.QueryContext(ctx, Key_SQL_TagCounts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var c TagCount
+		if err := rows.Scan(&c.Name, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func commentFields(c *Comment) []interface{} {
+	return []interface{}{&c.Id, &c.PostId, &c.ParentId, &c.Author,
+		&c.Date, &c.Modified, &c.Body, &c.Deleted, &c.Status, &c.Moderator}
+}
+
+const commentColumns = "id, postid, parentid, author, ctime, mtime, body, deleted, " +
+	"status, moderator"
+
+func (s *mysqlStore) AddComment(ctx context.Context, c *Comment) error {
+
+	q := "INSERT INTO comment (postid, parentid, author, ctime, mtime, body, status) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?)"
+	result, err := s.db.ExecContext(ctx, q, c.PostId, c.ParentId, c.Author,
+		c.Date, c.Modified, c.Body, c.Status)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.Id = id
+
+	return nil
+}
+
+func (s *mysqlStore) GetComment(ctx context.Context, id int64) (*Comment, error) {
+
+	var c Comment
+	q := `SELECT ` + commentColumns + ` FROM comment WHERE id = ?`
+	if err := s.db.QueryRowContext(ctx, q, id).Scan(commentFields(&c)...); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (s *mysqlStore) ListComments(ctx context.Context, postid int64) ([]Comment, error) {
+	q := `SELECT ` + commentColumns + ` FROM comment WHERE postid = ? ORDER BY id`
+	return s.queryComments(ctx, q, postid)
+}
+
+func (s *mysqlStore) ListCommentsByStatus(ctx context.Context, status string) ([]Comment, error) {
+	q := `SELECT ` + commentColumns + ` FROM comment WHERE status = ? ORDER BY id`
+	return s.queryComments(ctx, q, status)
+}
+
+func (s *mysqlStore) ListModeratedComments(ctx context.Context) ([]Comment, error) {
+	q := `SELECT ` + commentColumns + ` FROM comment WHERE moderator <> '' ORDER BY id`
+	return s.queryComments(ctx, q)
+}
+
+func (s *mysqlStore) queryComments(ctx context.Context, q string, args ...interface{}) ([]Comment, error) {
+
+	var cs []Comment
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(commentFields(&c)...); err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+func (s *mysqlStore) UpdateComment(ctx context.Context, c *Comment) error {
+
+	q := `UPDATE comment SET body = ?, status = ?, mtime = ? WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, q, c.Body, c.Status, c.Modified, c.Id)
+
+	return err
+}
+
+func (s *mysqlStore) DeleteComment(ctx context.Context, id int64) error {
+
+	q := `UPDATE comment SET body = '', deleted = TRUE WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, q, id)
+
+	return err
+}
+
+func (s *mysqlStore) ModerateComment(ctx context.Context, id int64, status, moderator string) error {
+
+	q := `UPDATE comment SET status = ?, moderator = ? WHERE id = ? AND status = 'pending'`
+	result, err := s.db.ExecContext(ctx, q, status, moderator, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func attachmentFields(a *Attachment) []interface{} {
+	return []interface{}{&a.Id, &a.PostId, &a.Author, &a.Name, &a.Type,
+		&a.Size, &a.Key, &a.Date, &a.Width, &a.Height}
+}
+
+const attachmentColumns = "id, postid, author, name, ctype, size, blobkey, ctime, " +
+	"width, height"
+
+func (s *mysqlStore) AddAttachment(ctx context.Context, a *Attachment) error {
+
+	q := "INSERT INTO attachment (postid, author, name, ctype, size, blobkey, ctime, " +
+		"width, height) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := s.db.ExecContext(ctx, q, a.PostId, a.Author, a.Name, a.Type,
+		a.Size, a.Key, a.Date, a.Width, a.Height)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	a.Id = id
+
+	return nil
+}
+
+func (s *mysqlStore) GetAttachment(ctx context.Context, id int64) (*Attachment, error) {
+
+	var a Attachment
+	q := `SELECT ` + attachmentColumns + ` FROM attachment WHERE id = ?`
+	if err := s.db.QueryRowContext(ctx, q, id).Scan(attachmentFields(&a)...); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (s *mysqlStore) GetAttachmentByKey(ctx context.Context, key string) (*Attachment, error) {
+
+	var a Attachment
+	q := `SELECT ` + attachmentColumns + ` FROM attachment WHERE blobkey = ?`
+	if err := s.db.QueryRowContext(ctx, q, key).Scan(attachmentFields(&a)...); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (s *mysqlStore) ListAttachments(ctx context.Context, postid int64) ([]Attachment, error) {
+
+	var as []Attachment
+
+	q := `SELECT ` + attachmentColumns + ` FROM attachment WHERE postid = ? ORDER BY id DESC`
+	rows, err := s.db.QueryContext(ctx, q, postid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(attachmentFields(&a)...); err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return as, nil
+}
+
+func (s *mysqlStore) DeleteAttachment(ctx context.Context, id int64) error {
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM attachment WHERE id = ?`, id)
+
+	return err
+}
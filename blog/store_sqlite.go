@@ -0,0 +1,124 @@
+package blog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore keeps all the data in a local sqlite file, so goblog can run
+// as one process without the mysql service. sqlite understands the queries
+// of mysqlStore except for the upsert of the vote statistics, and it needs
+// the times in one zone to compare them.
+type sqliteStore struct {
+	*mysqlStore
+}
+
+func newSqliteStore(db *sql.DB) *sqliteStore {
+	return &sqliteStore{newMysqlStore(db)}
+}
+
+func (s *sqliteStore) AddVote(ctx context.Context, postid int64, star int) error {
+
+	if star < 1 || star > 5 {
+		return fmt.Errorf("invalid star %d", star)
+	}
+
+	c := fmt.Sprintf("star%d", star)
+	q := `INSERT INTO poststatistics (postid,` + c + `) VALUES (?, 1)` +
+		` ON CONFLICT(postid) DO UPDATE SET ` + c + `=` + c + `+1`
+	_, err := s.db.ExecContext(ctx, q, postid)
+
+	return err
+}
+
+// sqlite compares and sorts the times as text, which is only right
+// when they are in the same zone, so the post times are kept in UTC.
+
+func utcPost(p *Post) *Post {
+	cp := *p
+	cp.Date, cp.Modified, cp.PublishAt = p.Date.UTC(), p.Modified.UTC(), p.PublishAt.UTC()
+	return &cp
+}
+
+func (s *sqliteStore) InsertPost(ctx context.Context, p *Post) error {
+
+	cp := utcPost(p)
+	if err := s.mysqlStore.InsertPost(ctx, cp); err != nil {
+		return err
+	}
+	p.Id, p.Version = cp.Id, cp.Version
+
+	return nil
+}
+
+func (s *sqliteStore) UpdatePost(ctx context.Context, p *Post) error {
+
+	cp := utcPost(p)
+	if err := s.mysqlStore.UpdatePost(ctx, cp); err != nil {
+		return err
+	}
+	p.Version = cp.Version
+
+	return nil
+}
+
+func (s *sqliteStore) SavePost(ctx context.Context, p *Post, r *Revision) ([]string, error) {
+
+	cp, cr := utcPost(p), *r
+	cr.Date = r.Date.UTC()
+	old, err := s.mysqlStore.SavePost(ctx, cp, &cr)
+	if err != nil {
+		return nil, err
+	}
+	p.Id, p.Version = cp.Id, cp.Version
+	r.Id, r.PostId = cr.Id, cr.PostId
+
+	return old, nil
+}
+
+func (s *sqliteStore) PublishScheduled(ctx context.Context, now time.Time) ([]int64, error) {
+	return s.mysqlStore.PublishScheduled(ctx, now.UTC())
+}
+
+func openSqlite(path string) (*sql.DB, error) {
+
+	q := url.Values{}
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Set("_time_format", "sqlite")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite allows only one writer at a time
+	db.SetMaxOpenConns(1)
+
+	return db, nil
+}
+
+func initSqliteHandler(path string) {
+
+	var err error
+	db, err = openSqlite(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	if err = db.PingContext(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("Connected!")
+}
@@ -0,0 +1,556 @@
+package blog
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hzget/goblog/blog/search"
+)
+
+// newTestSqliteStore opens a sqlite file in a temporary directory and
+// applies the sqlite migrations to it
+func newTestSqliteStore(t *testing.T) *sqliteStore {
+	path := t.TempDir() + "/db"
+	sdb, err := openSqlite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sdb.Close() })
+
+	// the migrator works on the globals
+	olddb, oldpath := db, sqlitePath
+	db, sqlitePath = sdb, path
+	defer func() { db, sqlitePath = olddb, oldpath }()
+
+	m, err := newMigrator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return newSqliteStore(sdb)
+}
+
+// useSqliteStore makes a new sqlite store the one of the blog until
+// the test ends
+func useSqliteStore(t *testing.T) *sqliteStore {
+	s := newTestSqliteStore(t)
+	ps, us, vs, rs := postStore, userStore, voteStore, revisionStore
+	ts, cs, as := tagStore, commentStore, attachmentStore
+	postStore, userStore, voteStore, revisionStore = s, s, s, s
+	tagStore, commentStore, attachmentStore = s, s, s
+	t.Cleanup(func() {
+		postStore, userStore, voteStore, revisionStore = ps, us, vs, rs
+		tagStore, commentStore, attachmentStore = ts, cs, as
+	})
+	return s
+}
+
+// testPost inserts a post of the author in the status, created and
+// published at the date
+func testPost(t *testing.T, s *sqliteStore, author, status string, date time.Time) *Post {
+	p := &Post{Title: "T", Author: author, Date: date, Modified: date, Body: "body",
+		Status: status, PublishAt: date, Format: FormatMarkdown}
+	if err := s.InsertPost(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestSqlitePosts(t *testing.T) {
+	s := newTestSqliteStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	p := testPost(t, s, "Lucy", StatusPublished, now)
+	if p.Id == 0 || p.Version != 1 {
+		t.Fatalf("want the id and version 1 set, got %d %d", p.Id, p.Version)
+	}
+
+	got, err := s.LoadPost(ctx, p.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != p.Title || got.Author != p.Author || got.Body != p.Body ||
+		got.Status != p.Status || got.Format != p.Format ||
+		!got.Date.Equal(now) || !got.PublishAt.Equal(now) {
+		t.Fatalf("want the post back as it was inserted, got %+v", got)
+	}
+
+	p.Title, p.Modified = "U", now.Add(time.Minute)
+	if err := s.UpdatePost(ctx, p); err != nil || p.Version != 2 {
+		t.Fatalf("want version 2, got %d %v", p.Version, err)
+	}
+	p.Version = 1
+	if err := s.UpdatePost(ctx, p); err != ErrVersionConflict {
+		t.Fatalf("want a version conflict, got %v", err)
+	}
+	if err := s.UpdatePost(ctx, &Post{Id: p.Id + 1, Title: "X"}); err != sql.ErrNoRows {
+		t.Fatalf("want no rows for a missing post, got %v", err)
+	}
+
+	info, err := s.GetPostInfo(ctx, p.Id)
+	if err != nil || info.Title != "U" || !info.Modified.Equal(p.Modified) || info.Star != [5]int64{} {
+		t.Fatalf("want the updated post without votes, got %+v %v", info, err)
+	}
+
+	draft := testPost(t, s, "Bob", StatusDraft, now)
+	if ps, err := s.ListPostsInfo(ctx, "Lucy"); err != nil || len(ps) != 1 {
+		t.Fatalf("want the published post only, got %v %v", ps, err)
+	}
+	if ps, err := s.ListPostsInfo(ctx, "Bob"); err != nil || len(ps) != 2 {
+		t.Fatalf("want the draft of Bob too, got %v %v", ps, err)
+	}
+	if ids, err := s.ListPostIds(ctx); err != nil || !reflect.DeepEqual(ids, []int64{p.Id, draft.Id}) {
+		t.Fatalf("want all the posts, got %v %v", ids, err)
+	}
+	if as, err := s.ListAuthors(ctx); err != nil || !reflect.DeepEqual(as, []string{"Bob", "Lucy"}) {
+		t.Fatalf("want the authors by name, got %v %v", as, err)
+	}
+
+	if err := s.DeletePost(ctx, draft.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.LoadPost(ctx, draft.Id); err != sql.ErrNoRows {
+		t.Fatalf("want the post deleted, got %v", err)
+	}
+}
+
+func TestSqliteUsers(t *testing.T) {
+	s := newTestSqliteStore(t)
+	ctx := context.Background()
+
+	for _, u := range []string{"Lucy", "Bob"} {
+		if err := s.CreateUser(ctx, u, "hash"+u, "bronze"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.CreateUser(ctx, "Bob", "", "bronze"); err == nil {
+		t.Fatal("want an error for a user twice")
+	}
+
+	if ok, err := s.UserExists(ctx, "Lucy"); err != nil || !ok {
+		t.Fatalf("want Lucy, got %v %v", ok, err)
+	}
+	if ok, err := s.UserExists(ctx, "Nobody"); err != nil || ok {
+		t.Fatalf("want no Nobody, got %v %v", ok, err)
+	}
+	if h, err := s.GetPassword(ctx, "Lucy"); err != nil || h != "hashLucy" {
+		t.Fatalf("want the hash of Lucy, got %q %v", h, err)
+	}
+
+	if err := s.UpdateRanks(ctx, []UserInfo{{"Lucy", "gold"}}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := s.GetUserInfo(ctx, "Lucy"); err != nil || info.Rank != "gold" {
+		t.Fatalf("want Lucy gold, got %v %v", info, err)
+	}
+	if err := s.UpdateRanks(ctx, []UserInfo{{"Bob", "silver"}, {"Lucy", "tin"}}); err == nil {
+		t.Fatal("want an error for an invalid rank")
+	}
+
+	if err := s.RemoveUser(ctx, "Lucy"); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := s.ListUsersInfo(ctx)
+	if err != nil || !reflect.DeepEqual(infos, []UserInfo{{"Bob", "bronze"}}) {
+		t.Fatalf("want Bob unchanged by the failed update, got %v %v", infos, err)
+	}
+}
+
+func TestSqliteVotes(t *testing.T) {
+	s := newTestSqliteStore(t)
+	ctx := context.Background()
+	p := testPost(t, s, "Lucy", StatusPublished, time.Now())
+
+	// the first vote of a post inserts its statistics, the next ones update them
+	for _, star := range []int{5, 5, 3} {
+		if err := s.AddVote(ctx, p.Id, star); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddVote(ctx, p.Id, 6); err == nil {
+		t.Fatal("want an error for star 6")
+	}
+
+	info, err := s.GetPostInfo(ctx, p.Id)
+	if err != nil || info.Star != [5]int64{0, 0, 1, 0, 2} {
+		t.Fatalf("want 1 vote of 3 and 2 of 5, got %v %v", info.Star, err)
+	}
+
+	if err := s.SetVotes(ctx, p.Id, [5]int64{1, 2, 3, 4, 5}); err != nil {
+		t.Fatal(err)
+	}
+	info, err = s.GetPostInfo(ctx, p.Id)
+	if err != nil || info.Star != [5]int64{1, 2, 3, 4, 5} {
+		t.Fatalf("want the votes replaced, got %v %v", info.Star, err)
+	}
+
+	if err := s.DeletePost(ctx, p.Id); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM poststatistics WHERE postid = ?`, p.Id).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("want the votes of a deleted post gone, got %d %v", n, err)
+	}
+}
+
+func TestSqliteRevisions(t *testing.T) {
+	s := newTestSqliteStore(t)
+	ctx := context.Background()
+	p := testPost(t, s, "Lucy", StatusPublished, time.Now())
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, body := range []string{"one", "two"} {
+		r := &Revision{PostId: p.Id, Author: "Lucy", Date: now, Title: "T", Body: body}
+		if err := s.AddRevision(ctx, r); err != nil || r.Id == 0 {
+			t.Fatalf("want the revision added, got %d %v", r.Id, err)
+		}
+	}
+
+	rs, err := s.ListRevisions(ctx, p.Id)
+	if err != nil || len(rs) != 2 || rs[0].Id < rs[1].Id || rs[0].Body != "" {
+		t.Fatalf("want 2 revisions newest first without body, got %+v %v", rs, err)
+	}
+	r, err := s.GetRevision(ctx, rs[0].Id)
+	if err != nil || r.Body != "two" || !r.Date.Equal(now) {
+		t.Fatalf("want the last revision, got %+v %v", r, err)
+	}
+}
+
+func TestSqliteSavePost(t *testing.T) {
+	s := newTestSqliteStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	p := &Post{Title: "T", Author: "Lucy", Date: now, Modified: now, Body: "one",
+		Status: StatusDraft, Format: FormatMarkdown, Tags: []string{"go"}}
+	old, err := s.SavePost(ctx, p, &Revision{Author: "Lucy", Date: now, Body: "one"})
+	if err != nil || p.Id == 0 || p.Version != 1 || len(old) != 0 {
+		t.Fatalf("want the post inserted, got %+v %v %v", p, old, err)
+	}
+
+	// nil tags keep the current ones
+	p.Body, p.Tags = "two", nil
+	old, err = s.SavePost(ctx, p, &Revision{Author: "Lucy", Date: now, Body: "two"})
+	if err != nil || p.Version != 2 || !reflect.DeepEqual(old, []string{"go"}) {
+		t.Fatalf("want the post updated, got %+v %v %v", p, old, err)
+	}
+
+	// a stale save leaves the post, its revisions and its tags as they were
+	p.Body, p.Version, p.Tags = "three", 1, []string{"sql"}
+	if _, err := s.SavePost(ctx, p, &Revision{Author: "Lucy", Date: now, Body: "three"}); err != ErrVersionConflict {
+		t.Fatalf("want a version conflict, got %v", err)
+	}
+
+	got, err := s.LoadPost(ctx, p.Id)
+	if err != nil || got.Body != "two" || !reflect.DeepEqual(got.Tags, []string{"go"}) {
+		t.Fatalf("want the second save, got %+v %v", got, err)
+	}
+	if rs, err := s.ListRevisions(ctx, p.Id); err != nil || len(rs) != 2 || rs[0].PostId != p.Id {
+		t.Fatalf("want a revision of each save, got %+v %v", rs, err)
+	}
+
+	// the tags fail after the post and its revision are written
+	if _, err := s.db.Exec(`DROP TABLE posttag`); err != nil {
+		t.Fatal(err)
+	}
+	p.Version = 2
+	if _, err := s.SavePost(ctx, p, &Revision{Author: "Lucy", Date: now, Body: "three"}); err == nil {
+		t.Fatal("want the save failed without the tag table")
+	}
+	var body string
+	var version int64
+	err = s.db.QueryRow(`SELECT body, version FROM post WHERE id = ?`, p.Id).Scan(&body, &version)
+	if err != nil || body != "two" || version != 2 {
+		t.Fatalf("want the post rolled back, got %q %d %v", body, version, err)
+	}
+	if rs, err := s.ListRevisions(ctx, p.Id); err != nil || len(rs) != 2 {
+		t.Fatalf("want the revision rolled back, got %+v %v", rs, err)
+	}
+}
+
+func TestSqlitePublishScheduled(t *testing.T) {
+	s := newTestSqliteStore(t)
+	ctx := context.Background()
+
+	// the publish times are in another zone than now
+	now := time.Now()
+	zone := time.FixedZone("west", -10*3600)
+	due := testPost(t, s, "Lucy", StatusScheduled, now.Add(-time.Minute).In(zone))
+	later := testPost(t, s, "Lucy", StatusScheduled, now.Add(time.Minute).In(zone))
+	testPost(t, s, "Lucy", StatusDraft, now.Add(-time.Hour))
+
+	ids, err := s.PublishScheduled(ctx, now)
+	if err != nil || !reflect.DeepEqual(ids, []int64{due.Id}) {
+		t.Fatalf("want post %d published, got %v %v", due.Id, ids, err)
+	}
+	if p, err := s.LoadPost(ctx, later.Id); err != nil || p.Status != StatusScheduled {
+		t.Fatalf("want post %d still scheduled, got %v %v", later.Id, p, err)
+	}
+	if p, err := s.LoadPost(ctx, due.Id); err != nil || p.Status != StatusPublished || p.Version != 2 {
+		t.Fatalf("want post %d published in version 2, got %v %v", due.Id, p, err)
+	}
+}
+
+func TestPublishScheduledPosts(t *testing.T) {
+	s := useSqliteStore(t)
+	x := searchIndex
+	searchIndex = search.NewIndex()
+	t.Cleanup(func() { searchIndex = x })
+
+	now := time.Now()
+	due := testPost(t, s, "Lucy", StatusScheduled, now.Add(-time.Minute))
+	later := testPost(t, s, "Lucy", StatusScheduled, now.Add(time.Hour))
+
+	publishScheduledPosts()
+
+	if p, err := s.LoadPost(context.Background(), due.Id); err != nil || p.Status != StatusPublished {
+		t.Fatalf("want post %d published, got %v %v", due.Id, p, err)
+	}
+	if p, err := s.LoadPost(context.Background(), later.Id); err != nil || p.Status != StatusScheduled {
+		t.Fatalf("want post %d still scheduled, got %v %v", later.Id, p, err)
+	}
+	if hits := searchIndex.Search("body", 10); len(hits) != 1 || hits[0].Id != due.Id {
+		t.Fatalf("want post %d indexed alone, got %v", due.Id, hits)
+	}
+}
+
+func TestSqliteDraftPublishTime(t *testing.T) {
+	s := newTestSqliteStore(t)
+	ctx := context.Background()
+
+	// a draft never published has no publish time
+	p := testPost(t, s, "Lucy", StatusDraft, time.Time{})
+	got, err := s.LoadPost(ctx, p.Id)
+	if err != nil || !got.PublishAt.IsZero() {
+		t.Fatalf("want no publish time, got %v %v", got, err)
+	}
+	ps, err := s.ListPostSummaries(ctx, &PostListQuery{Viewer: "Lucy", Sort: SortCtime, Limit: 10})
+	if err != nil || len(ps) != 1 || !ps[0].PublishAt.IsZero() {
+		t.Fatalf("want the draft listed without publish time, got %+v %v", ps, err)
+	}
+}
+
+func TestSqliteTags(t *testing.T) {
+	s := newTestSqliteStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	old := testPost(t, s, "Lucy", StatusPublished, now.Add(-time.Hour))
+	recent := testPost(t, s, "Lucy", StatusPublished, now)
+	draft := testPost(t, s, "Lucy", StatusDraft, now)
+	for _, p := range []*Post{old, recent, draft} {
+		if err := s.SetPostTags(ctx, p.Id, []string{"go", "sql"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SetPostTags(ctx, old.Id, []string{"go"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if tags, err := s.GetPostTags(ctx, recent.Id); err != nil || !reflect.DeepEqual(tags, []string{"go", "sql"}) {
+		t.Fatalf("want the tags by name, got %v %v", tags, err)
+	}
+	if p, err := s.LoadPost(ctx, old.Id); err != nil || !reflect.DeepEqual(p.Tags, []string{"go"}) {
+		t.Fatalf("want the tags replaced, got %v %v", p, err)
+	}
+
+	ps, err := s.ListTagPosts(ctx, "go")
+	if err != nil || len(ps) != 2 || ps[0].Id != recent.Id || ps[1].Id != old.Id {
+		t.Fatalf("want the published posts newest first, got %v %v", ps, err)
+	}
+	counts, err := s.TagCounts(ctx)
+	if err != nil || !reflect.DeepEqual(counts, []TagCount{{"go", 2}, {"sql", 1}}) {
+		t.Fatalf("want the published posts of each tag, got %v %v", counts, err)
+	}
+
+	if err := s.DeletePost(ctx, recent.Id); err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := s.GetPostTags(ctx, recent.Id); err != nil || len(tags) != 0 {
+		t.Fatalf("want the tags of a deleted post gone, got %v %v", tags, err)
+	}
+}
+
+func TestSqliteComments(t *testing.T) {
+	s := newTestSqliteStore(t)
+	ctx := context.Background()
+	p := testPost(t, s, "Lucy", StatusPublished, time.Now())
+
+	now := time.Now().UTC().Truncate(time.Second)
+	add := func(parent int64, status string) *Comment {
+		c := &Comment{PostId: p.Id, ParentId: parent, Author: "Bob", Date: now,
+			Modified: now, Body: "hi", Status: status}
+		if err := s.AddComment(ctx, c); err != nil || c.Id == 0 {
+			t.Fatalf("want the comment added, got %d %v", c.Id, err)
+		}
+		return c
+	}
+	top := add(0, CommentApproved)
+	reply := add(top.Id, CommentPending)
+
+	c, err := s.GetComment(ctx, reply.Id)
+	if err != nil || c.ParentId != top.Id || c.Deleted || c.Status != CommentPending || !c.Date.Equal(now) {
+		t.Fatalf("want the reply back, got %+v %v", c, err)
+	}
+
+	c.Body, c.Modified = "edited", now.Add(time.Minute)
+	if err := s.UpdateComment(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if cs, err := s.ListCommentsByStatus(ctx, CommentPending); err != nil || len(cs) != 1 || cs[0].Body != "edited" {
+		t.Fatalf("want the edited reply pending, got %+v %v", cs, err)
+	}
+
+	if err := s.ModerateComment(ctx, reply.Id, CommentApproved, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ModerateComment(ctx, reply.Id, CommentRejected, "admin"); err != sql.ErrNoRows {
+		t.Fatalf("want a comment moderated once, got %v", err)
+	}
+	if cs, err := s.ListModeratedComments(ctx); err != nil || len(cs) != 1 || cs[0].Moderator != "admin" {
+		t.Fatalf("want the moderated reply, got %+v %v", cs, err)
+	}
+
+	if err := s.DeleteComment(ctx, top.Id); err != nil {
+		t.Fatal(err)
+	}
+	cs, err := s.ListComments(ctx, p.Id)
+	if err != nil || len(cs) != 2 || cs[0].Id != top.Id || !cs[0].Deleted || cs[0].Body != "" {
+		t.Fatalf("want the deleted comment kept without body, got %+v %v", cs, err)
+	}
+	if cs[1].Body != "edited" || !cs[1].Modified.Equal(c.Modified) {
+		t.Fatalf("want the reply edited, got %+v", cs[1])
+	}
+
+	if err := s.DeletePost(ctx, p.Id); err != nil {
+		t.Fatal(err)
+	}
+	if cs, err := s.ListComments(ctx, p.Id); err != nil || len(cs) != 0 {
+		t.Fatalf("want the comments of a deleted post gone, got %v %v", cs, err)
+	}
+}
+
+func TestSqlitePostList(t *testing.T) {
+	s := newTestSqliteStore(t)
+	ctx := context.Background()
+
+	// the times are in another zone than the cursor of the list
+	zone := time.FixedZone("east", 8*3600)
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, zone)
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		p := testPost(t, s, "Lucy", StatusPublished, base.Add(time.Duration(i)*time.Hour))
+		ids = append(ids, p.Id)
+	}
+	testPost(t, s, "Bob", StatusDraft, base)
+	s.AddVote(ctx, ids[1], 5)
+	s.AddVote(ctx, ids[3], 1)
+
+	for _, c := range []struct {
+		sort string
+		asc  bool
+		want []int64
+	}{
+		{SortCtime, false, []int64{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+		{SortCtime, true, ids},
+		{SortMtime, false, []int64{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+		{SortPublished, false, []int64{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+		{SortStars, false, []int64{ids[1], ids[3], ids[4], ids[2], ids[0]}},
+		{SortVotes, false, []int64{ids[3], ids[1], ids[4], ids[2], ids[0]}},
+	} {
+		// two at a time, each page after the last post of the one before
+		var got []int64
+		q := &PostListQuery{Viewer: "Lucy", Sort: c.sort, Asc: c.asc, Limit: 2}
+		for {
+			ps, err := s.ListPostSummaries(ctx, q)
+			if err != nil {
+				t.Fatalf("%s: %v", c.sort, err)
+			}
+			for _, p := range ps {
+				got = append(got, p.Id)
+			}
+			if len(ps) < q.Limit || len(got) > len(c.want) {
+				break
+			}
+			last := &ps[len(ps)-1]
+			if q.AfterKey, err = parseSortKey(c.sort, sortKey(last, c.sort)); err != nil {
+				t.Fatal(err)
+			}
+			q.AfterId = last.Id
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s asc %v: want %v, got %v", c.sort, c.asc, c.want, got)
+		}
+	}
+
+	ps, err := s.ListPostSummaries(ctx, &PostListQuery{Viewer: "Bob", Author: "Bob", Sort: SortCtime, Limit: 10})
+	if err != nil || len(ps) != 1 || ps[0].Excerpt != "body" {
+		t.Fatalf("want the draft of Bob, got %+v %v", ps, err)
+	}
+
+	if n, err := s.CountPublishedPosts(ctx); err != nil || n != 5 {
+		t.Fatalf("want 5 published posts, got %d %v", n, err)
+	}
+	stamps, err := s.ListPublishedPosts(ctx, 3, 10)
+	if err != nil || len(stamps) != 2 || stamps[0].Id != ids[3] || !stamps[1].Modified.Equal(base.Add(4*time.Hour)) {
+		t.Fatalf("want the last 2 published posts, got %v %v", stamps, err)
+	}
+}
+
+func TestSqliteAttachments(t *testing.T) {
+	s := newTestSqliteStore(t)
+	ctx := context.Background()
+	p := testPost(t, s, "Lucy", StatusPublished, time.Now())
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var as []*Attachment
+	for _, key := range []string{"a.png", "b.txt"} {
+		a := &Attachment{PostId: p.Id, Author: "Lucy", Name: key, Type: "image/png",
+			Size: 10, Key: key, Date: now, Width: 2, Height: 1}
+		if err := s.AddAttachment(ctx, a); err != nil || a.Id == 0 {
+			t.Fatalf("want the attachment added, got %d %v", a.Id, err)
+		}
+		as = append(as, a)
+	}
+	if err := s.AddAttachment(ctx, &Attachment{PostId: p.Id, Key: "a.png", Date: now}); err == nil {
+		t.Fatal("want an error for a key twice")
+	}
+
+	a, err := s.GetAttachment(ctx, as[0].Id)
+	if err != nil || !reflect.DeepEqual(a.Date.UTC(), now) {
+		t.Fatalf("want the attachment back, got %+v %v", a, err)
+	}
+	a.Date = as[0].Date
+	if !reflect.DeepEqual(a, as[0]) {
+		t.Fatalf("want %+v, got %+v", as[0], a)
+	}
+	if a, err := s.GetAttachmentByKey(ctx, "b.txt"); err != nil || a.Id != as[1].Id {
+		t.Fatalf("want the attachment by key, got %+v %v", a, err)
+	}
+
+	list, err := s.ListAttachments(ctx, p.Id)
+	if err != nil || len(list) != 2 || list[0].Id != as[1].Id {
+		t.Fatalf("want the attachments newest first, got %+v %v", list, err)
+	}
+
+	if err := s.DeleteAttachment(ctx, as[1].Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetAttachmentByKey(ctx, "b.txt"); err != sql.ErrNoRows {
+		t.Fatalf("want the attachment deleted, got %v", err)
+	}
+
+	if err := s.DeletePost(ctx, p.Id); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := s.ListAttachments(ctx, p.Id); err != nil || len(list) != 0 {
+		t.Fatalf("want the attachments of a deleted post gone, got %v %v", list, err)
+	}
+}
@@ -0,0 +1,176 @@
+package blog
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hzget/goblog/blog/search"
+)
+
+// memStore keeps posts and users in memory. The methods it does not
+// fake are left to the nil interfaces it embeds and panic if called.
+type memStore struct {
+	PostStore
+	UserStore
+
+	mu    sync.Mutex
+	posts map[int64]*Post
+	users map[string]string // username -> password hash
+}
+
+func newMemStore() *memStore {
+	return &memStore{posts: map[int64]*Post{}, users: map[string]string{}}
+}
+
+func (s *memStore) InsertPost(ctx context.Context, p *Post) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p.Id = int64(len(s.posts) + 1)
+	cp := *p
+	s.posts[p.Id] = &cp
+	return nil
+}
+
+func (s *memStore) LoadPost(ctx context.Context, id int64) (*Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.posts[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	cp := *p
+	return &cp, nil
+}
+
+func (s *memStore) GetPostInfo(ctx context.Context, id int64) (PostInfo, error) {
+	p, err := s.LoadPost(ctx, id)
+	if err != nil {
+		return PostInfo{}, err
+	}
+	return PostInfo{Post: *p}, nil
+}
+
+func (s *memStore) CreateUser(ctx context.Context, username, hash, rank string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[username] = hash
+	return nil
+}
+
+func (s *memStore) UserExists(ctx context.Context, username string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.users[username]
+	return ok, nil
+}
+
+// useMemStore makes the post and user stores a new memStore until the
+// test ends
+func useMemStore(t *testing.T) *memStore {
+	s := newMemStore()
+	ps, us := postStore, userStore
+	postStore, userStore = s, s
+	t.Cleanup(func() { postStore, userStore = ps, us })
+	return s
+}
+
+func TestMemStoreHandlers(t *testing.T) {
+	s := useMemStore(t)
+
+	signup := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/signup", strings.NewReader(`{"username":"Lucy", "password":"12345"}`))
+		w := httptest.NewRecorder()
+		signupHandler(w, req)
+		return w
+	}
+	if w := signup(); w.Code != http.StatusOK {
+		t.Fatalf("want signup success, got %d %s", w.Code, w.Body.String())
+	}
+	if hash, ok := s.users["Lucy"]; !ok || validateHash("12345", hash) != nil {
+		t.Fatalf("want Lucy stored with the hash of the password, got %q", hash)
+	}
+	if w := signup(); w.Code != http.StatusBadRequest {
+		t.Fatalf("want the second signup refused, got %d %s", w.Code, w.Body.String())
+	}
+
+	p := &Post{Title: "Hello", Author: "Lucy", Body: "in memory"}
+	s.InsertPost(context.Background(), p)
+
+	viewjs := func(id int64) (*viewResp, *appError) {
+		req := httptest.NewRequest("POST", "/viewjs", strings.NewReader(encodeJson(viewReq{id})))
+		w := httptest.NewRecorder()
+		e := viewjsHandler(w, req, &PageInfo{Username: "Lucy"})
+		resp := &viewResp{}
+		if e == nil {
+			if err := decodeJson(w.Body.Bytes(), resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp, e
+	}
+	if resp, e := viewjs(p.Id); e != nil || resp.Title != "Hello" || resp.Body != "in memory" {
+		t.Fatalf("want post %d viewed, got %+v %v", p.Id, resp, e)
+	}
+	if _, e := viewjs(p.Id + 1); e == nil || e.Code != http.StatusBadRequest {
+		t.Fatalf("want a missing post refused, got %v", e)
+	}
+}
+
+func TestSearchStaleHit(t *testing.T) {
+	s := useMemStore(t)
+	x := searchIndex
+	searchIndex = search.NewIndex()
+	t.Cleanup(func() { searchIndex = x })
+
+	p := &Post{Title: "Hello", Author: "Lucy", Body: "zebrafish", Status: StatusPublished}
+	s.InsertPost(context.Background(), p)
+	searchIndex.Add(p.Id, p.Title, p.Body)
+	searchIndex.Add(p.Id+1, "Gone", "zebrafish")
+
+	results, err := searchPosts("zebrafish", 10)
+	if err != nil || len(results) != 1 || results[0].Id != p.Id {
+		t.Fatalf("want post %d found without the missing one, got %+v %v", p.Id, results, err)
+	}
+	if searchIndex.Len() != 1 {
+		t.Fatalf("want the stale hit removed, got %d posts in the index", searchIndex.Len())
+	}
+}
+
+func TestCheckMarkdownAuthors(t *testing.T) {
+	s := useMemStore(t)
+	s.CreateUser(context.Background(), "Lucy", "", "")
+	s.CreateUser(context.Background(), "admin", "", "")
+
+	read := func() []mdPost {
+		return []mdPost{
+			{File: "a.md", Post: &Post{Author: "Lucy"}},
+			{File: "b.md", Post: &Post{Author: "Bob"}},
+			{File: "c.md", Skip: "no title"},
+		}
+	}
+
+	posts := read()
+	if err := checkMarkdownAuthors(posts, ""); err != nil {
+		t.Fatal(err)
+	}
+	if posts[0].Skip != "" || posts[1].Skip == "" || posts[2].Skip != "no title" {
+		t.Fatalf("want the post of an unknown author skipped, got %+v", posts)
+	}
+
+	posts = read()
+	if err := checkMarkdownAuthors(posts, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if posts[0].Post.Author != "Lucy" || posts[1].Skip != "" || posts[1].Post.Author != "admin" {
+		t.Fatalf("want the post of an unknown author given to admin, got %+v", posts)
+	}
+
+	if err := checkMarkdownAuthors(read(), "nobody"); err == nil {
+		t.Fatal("want an unknown -author refused")
+	}
+}
@@ -27,15 +27,10 @@ func getRankInt(rank string) int64 {
 
 func getUserInfo(username string) (*UserInfo, error) {
 
-	info := &UserInfo{Username: username}
-
 	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
 	defer cancel()
 
-	q := "select `rank` from users where username = ?"
-	err := db.QueryRowContext(ctx, q, username).Scan(&info.Rank)
-
-	return info, err
+	return userStore.GetUserInfo(ctx, username)
 }
 
 func getUsersInfo() ([]UserInfo, error) {
@@ -43,31 +38,7 @@ func getUsersInfo() ([]UserInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
 	defer cancel()
 
-	var s []UserInfo
-	q := "select username, `rank` from users"
-
-	rows, err := db.QueryContext(ctx, q)
-
-	if err != nil {
-		return nil, err
-	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		var info UserInfo
-		if err := rows.Scan(&info.Username, &info.Rank); err != nil {
-			return nil, err
-		}
-
-		s = append(s, info)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return s, nil
+	return userStore.ListUsersInfo(ctx)
 }
 
 func superadminHandler(w http.ResponseWriter, r *http.Request) {
@@ -104,24 +75,7 @@ func saveranksHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
 	defer cancel()
 
-	// Get a Tx for making transaction requests.
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		fail(err)
-		return
-	}
-	defer tx.Rollback()
-
-	q := "UPDATE users SET `rank` = ? WHERE username = ?"
-	for _, info := range data.Pairs {
-		_, err = tx.ExecContext(ctx, q, info.Rank, info.Username)
-		if err != nil {
-			fail(err)
-			return
-		}
-	}
-
-	if err = tx.Commit(); err != nil {
+	if err := userStore.UpdateRanks(ctx, data.Pairs); err != nil {
 		fail(err)
 		return
 	}
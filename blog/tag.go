@@ -0,0 +1,160 @@
+package blog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+const (
+	regexTag   = `^[0-9a-z_\-]{1,32}$`
+	maxPostTag = 10
+)
+
+// normalizeTags lowercases, trims and dedups the tags
+func normalizeTags(tags []string) ([]string, error) {
+
+	seen := make(map[string]bool)
+	norm := []string{}
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+
+		if match, err := regexp.MatchString(regexTag, t); !match || err != nil {
+			return nil, fmt.Errorf("invalid tag %q: only letters, digits, "+
+				"'-' and '_' are allowed, at most 32 characters", t)
+		}
+
+		seen[t] = true
+		norm = append(norm, t)
+	}
+
+	if len(norm) > maxPostTag {
+		return nil, fmt.Errorf("a post can have at most %d tags", maxPostTag)
+	}
+
+	sort.Strings(norm)
+
+	return norm, nil
+}
+
+func getPostTags(postid int64) ([]string, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	return tagStore.GetPostTags(ctx, postid)
+}
+
+func setPostTags(postid int64, tags []string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	return tagStore.SetPostTags(ctx, postid, tags)
+}
+
+func getTagPosts(tag string) ([]Post, error) {
+
+	var ps []Post
+	key := Key_SQL_ListTagPosts + tag
+	if err := DBGetCache(key, &ps); err == nil {
+		return ps, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	ps, err := tagStore.ListTagPosts(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	DBUpdateCache(key, ps)
+
+	return ps, nil
+}
+
+func getTagCounts() ([]TagCount, error) {
+
+	var counts []TagCount
+	if err := DBGetCache(Key_SQL_TagCounts, &counts); err == nil {
+		return counts, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	counts, err := tagStore.TagCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	DBUpdateCache(Key_SQL_TagCounts, counts)
+
+	return counts, nil
+}
+
+// removeTagCache drops the cached listings of the tags and the tag counts.
+// it shall be called whenever a post of these tags is changed.
+func removeTagCache(tags ...string) {
+	for _, t := range tags {
+		DBRemoveCache(Key_SQL_ListTagPosts + t)
+	}
+	DBRemoveCache(Key_SQL_TagCounts)
+}
+
+// removePostTagCache drops the cached listings of the tags of the post
+func removePostTagCache(postid int64) {
+	tags, err := getPostTags(postid)
+	if err != nil {
+		Warn(fmt.Sprintf("fail to get tags of post %d: %v", postid, err))
+	}
+	removeTagCache(tags...)
+}
+
+func tagHandler(w http.ResponseWriter, r *http.Request) {
+
+	tag := strings.TrimPrefix(r.URL.Path, sitePrefix+"/tag/")
+	if match, err := regexp.MatchString(regexTag, tag); !match || err != nil {
+		printAlert(w, "the tag is invalid: "+tag,
+			http.StatusBadRequest)
+		return
+	}
+
+	ps, err := getTagPosts(tag)
+	if err != nil {
+		printAlert(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Tag   string
+		Posts []Post
+	}{tag, ps}
+
+	renderTemplate(w, "tag.html", data)
+}
+
+// tagSize returns the font size in percent of a tag in the tag cloud
+func tagSize(count int64, counts []TagCount) int64 {
+
+	var max int64 = 1
+	for _, c := range counts {
+		if c.Count > max {
+			max = c.Count
+		}
+	}
+
+	return 80 + 120*count/max
+}
@@ -0,0 +1,143 @@
+// Package textdiff computes a line-level diff between two texts.
+package textdiff
+
+import (
+	"strings"
+)
+
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+func (op Op) String() string {
+	switch op {
+	case Insert:
+		return "+"
+	case Delete:
+		return "-"
+	default:
+		return " "
+	}
+}
+
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// above this number of cells the lcs table is not built and the changed
+// part of the texts is reported as deleted and inserted as a whole
+const maxCells = 4 << 20
+
+// Lines returns the lines of a and b in order, each marked as kept,
+// deleted from a or inserted from b, with a longest common subsequence
+// of the lines kept.
+func Lines(a, b string) []Line {
+
+	x, y := split(a), split(b)
+
+	// the common prefix and suffix need no lcs table
+	pre := 0
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		pre++
+	}
+
+	suf := 0
+	for suf < len(x)-pre && suf < len(y)-pre &&
+		x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+
+	var lines []Line
+	for _, s := range x[:pre] {
+		lines = append(lines, Line{Equal, s})
+	}
+
+	lines = append(lines, lcs(x[pre:len(x)-suf], y[pre:len(y)-suf])...)
+
+	for _, s := range x[len(x)-suf:] {
+		lines = append(lines, Line{Equal, s})
+	}
+
+	return lines
+}
+
+// Changed reports whether the diff contains any inserted or deleted line.
+func Changed(lines []Line) bool {
+	for _, l := range lines {
+		if l.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func lcs(x, y []string) []Line {
+
+	var lines []Line
+	n, m := len(x), len(y)
+
+	if n*m == 0 || n*m > maxCells {
+		for _, s := range x {
+			lines = append(lines, Line{Delete, s})
+		}
+		for _, s := range y {
+			lines = append(lines, Line{Insert, s})
+		}
+		return lines
+	}
+
+	// t[i][j] is the length of the lcs of x[i:] and y[j:]
+	t := make([][]int32, n+1)
+	for i := range t {
+		t[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case x[i] == y[j]:
+				t[i][j] = t[i+1][j+1] + 1
+			case t[i+1][j] >= t[i][j+1]:
+				t[i][j] = t[i+1][j]
+			default:
+				t[i][j] = t[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case x[i] == y[j]:
+			lines = append(lines, Line{Equal, x[i]})
+			i++
+			j++
+		case t[i+1][j] >= t[i][j+1]:
+			lines = append(lines, Line{Delete, x[i]})
+			i++
+		default:
+			lines = append(lines, Line{Insert, y[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		lines = append(lines, Line{Delete, x[i]})
+	}
+	for ; j < m; j++ {
+		lines = append(lines, Line{Insert, y[j]})
+	}
+
+	return lines
+}
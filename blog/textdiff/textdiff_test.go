@@ -0,0 +1,42 @@
+package textdiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{"Empty", "", "", nil},
+		{"Same", "a\nb", "a\nb\n", []Line{{Equal, "a"}, {Equal, "b"}}},
+		{"AllNew", "", "a\nb", []Line{{Insert, "a"}, {Insert, "b"}}},
+		{"AllRemoved", "a\nb", "", []Line{{Delete, "a"}, {Delete, "b"}}},
+		{"Changed", "a\nb\nc", "a\nx\nc", []Line{
+			{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c"}}},
+		{"Moved", "a\nb\nc\nd", "b\nc\na\nd", []Line{
+			{Delete, "a"}, {Equal, "b"}, {Equal, "c"}, {Insert, "a"}, {Equal, "d"}}},
+		{"CRLF", "a\r\nb", "a\nb", []Line{{Equal, "a"}, {Equal, "b"}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Lines(tc.a, tc.b)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestChanged(t *testing.T) {
+	if Changed(Lines("a\nb", "a\nb")) {
+		t.Fatal("want unchanged for equal texts")
+	}
+	if !Changed(Lines("a\nb", "a\nc")) {
+		t.Fatal("want changed for different texts")
+	}
+}
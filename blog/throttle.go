@@ -0,0 +1,262 @@
+package blog
+
+/*
+ * login throttling: the failed signins are counted per username and per
+ * IP for a window of time
+ *
+ *     loginfail:user:#name    loginfail:ip:#ip      the failures
+ *     loginlock:user:#name    loginlock:ip:#ip      the lockouts
+ *
+ * After the free attempts every failure locks the signins for twice
+ * as long as the one before, up to a maximum. A signin that succeeds
+ * clears the failures of the username, the ones of the IP go with the
+ * window only.
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	loginFailPrefix = "loginfail:"
+	loginLockPrefix = "loginlock:"
+
+	LockUser = "user"
+	LockIP   = "ip"
+
+	defaultLoginAttempts   = 5
+	defaultLoginIPAttempts = 50
+	defaultLoginLockout    = 30 * time.Second
+	defaultLoginMaxLockout = time.Hour
+	defaultLoginWindow     = 24 * time.Hour
+
+	// the same answer whether the user exists or not
+	msgSigninFailed = "invalid username or password"
+	msgSigninLocked = "too many failed attempts, please try again later"
+)
+
+// loginLimit is the number of failures allowed before the lockouts start
+type loginLimit struct {
+	kind string
+	free int
+}
+
+/* not thread-safe: assigned once during initialization */
+var loginUserLimit = loginLimit{LockUser, defaultLoginAttempts}
+var loginIPLimit = loginLimit{LockIP, defaultLoginIPAttempts}
+var loginLockout, loginMaxLockout, loginWindow time.Duration
+
+// dummyHash is checked against when there is no such user, so that the
+// time of the answer does not tell that either
+var dummyHash []byte
+
+// Lockout is a username or an IP that cannot sign in for a while
+type Lockout struct {
+	Kind      string        `json:"kind"`
+	Name      string        `json:"name"`
+	Failures  int64         `json:"failures"`
+	Remaining time.Duration `json:"remaining"`
+}
+
+// failScript counts a failure and locks if there were too many,
+// it returns the seconds of the lockout
+var failScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+redis.call("EXPIRE", KEYS[1], ARGV[1])
+local free = tonumber(ARGV[2])
+if n <= free then
+	return 0
+end
+local ttl = tonumber(ARGV[3]) * 2 ^ (n - free - 1)
+if ttl > tonumber(ARGV[4]) then
+	ttl = tonumber(ARGV[4])
+end
+ttl = math.floor(ttl)
+redis.call("SET", KEYS[2], n, "EX", ttl)
+return ttl
+`)
+
+func setLoginLimits(attempts, ipAttempts int, lockout, maxLockout, window time.Duration) {
+
+	if attempts > 0 {
+		loginUserLimit.free = attempts
+	}
+	if ipAttempts > 0 {
+		loginIPLimit.free = ipAttempts
+	}
+	if loginLockout = lockout; loginLockout < time.Second {
+		loginLockout = defaultLoginLockout
+	}
+	if loginMaxLockout = maxLockout; loginMaxLockout < loginLockout {
+		loginMaxLockout = defaultLoginMaxLockout
+	}
+	if loginWindow = window; loginWindow < loginMaxLockout {
+		loginWindow = defaultLoginWindow
+	}
+
+	var err error
+	if dummyHash, err = bcrypt.GenerateFromPassword([]byte("no such user"), 8); err != nil {
+		panic(err)
+	}
+}
+
+func loginKey(prefix, kind, name string) string {
+	return prefix + kind + ":" + name
+}
+
+// loginLocked returns how long the user or the ip cannot sign in
+func loginLocked(user, ip string) (time.Duration, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	var locked time.Duration
+	for _, key := range []string{loginKey(loginLockPrefix, LockUser, user),
+		loginKey(loginLockPrefix, LockIP, ip)} {
+		ttl, err := rdb.PTTL(ctx, key).Result()
+		if err != nil {
+			return 0, err
+		}
+		// a key that is not there has a negative ttl
+		if ttl > locked {
+			locked = ttl
+		}
+	}
+
+	return locked, nil
+}
+
+// loginFailed counts a failed signin of the user from the ip and returns
+// how long they are locked out for it
+func loginFailed(user, ip string) (time.Duration, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	var locked time.Duration
+	for _, l := range []struct {
+		loginLimit
+		name string
+	}{{loginUserLimit, user}, {loginIPLimit, ip}} {
+		keys := []string{loginKey(loginFailPrefix, l.kind, l.name), loginKey(loginLockPrefix, l.kind, l.name)}
+		secs, err := failScript.Run(ctx, rdb, keys, int64(loginWindow/time.Second), l.free,
+			int64(loginLockout/time.Second), int64(loginMaxLockout/time.Second)).Int64()
+		if err != nil {
+			return 0, err
+		}
+		if d := time.Duration(secs) * time.Second; d > locked {
+			locked = d
+		}
+	}
+
+	if locked > 0 {
+		Warn(fmt.Sprintf("signin of %s from %s locked for %v", user, ip, locked))
+	}
+
+	return locked, nil
+}
+
+// unlockLogin clears the failures and the lockout of a username or an ip
+func unlockLogin(kind, name string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	return rdb.Del(ctx, loginKey(loginFailPrefix, kind, name), loginKey(loginLockPrefix, kind, name)).Err()
+}
+
+// respondLocked tells the client to come back later, it is not told
+// whether the user exists
+func respondLocked(w http.ResponseWriter, locked time.Duration) {
+	secs := int64((locked + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+	http.Error(w, encodeJsonResp(false, msgSigninLocked), http.StatusTooManyRequests)
+}
+
+// listLockouts returns the usernames and ips locked out, the longest first
+func listLockouts() ([]Lockout, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
+	defer cancel()
+
+	var ls []Lockout
+	iter := rdb.Scan(ctx, 0, loginLockPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		kindName := strings.SplitN(strings.TrimPrefix(key, loginLockPrefix), ":", 2)
+		if len(kindName) != 2 {
+			continue
+		}
+
+		n, err := rdb.Get(ctx, key).Int64()
+		if err == redis.Nil {
+			// it expired meanwhile
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		ttl, err := rdb.PTTL(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ttl <= 0 {
+			continue
+		}
+
+		ls = append(ls, Lockout{kindName[0], kindName[1], n, ttl})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ls, func(i, j int) bool { return ls[i].Remaining > ls[j].Remaining })
+
+	return ls, nil
+}
+
+func lockoutsHandler(w http.ResponseWriter, r *http.Request) {
+
+	data, err := listLockouts()
+	if err != nil {
+		printAlert(w, fmt.Sprintf("get lockouts failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	renderTemplate(w, "lockouts.html", data)
+}
+
+func unlockjsHandler(w http.ResponseWriter, r *http.Request) {
+
+	var req = struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	}{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil || req.Name == "" ||
+		req.Kind != LockUser && req.Kind != LockIP {
+		http.Error(w, encodeJsonResp(false, "a kind, user or ip, and a name are required"),
+			http.StatusBadRequest)
+		return
+	}
+
+	if err := unlockLogin(req.Kind, req.Name); err != nil {
+		fmt.Printf("internal error %v\n", err)
+		http.Error(w, encodeJsonResp(false, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	Info(fmt.Sprintf("the signins of %s %s are unlocked", req.Kind, req.Name))
+	fmt.Fprint(w, encodeJsonResp(true, "unlocked"))
+}
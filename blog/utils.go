@@ -2,12 +2,15 @@ package blog
 
 import (
 	"fmt"
+	"html/template"
 	"net/http"
-	"text/template"
 )
 
 func add(a, b int) int              { return a + b }
 func multiple(a, b float64) float64 { return a * b }
+func statuses() []string {
+	return []string{StatusDraft, StatusPublished, StatusScheduled, StatusArchived}
+}
 
 func printAlert(w http.ResponseWriter, msg string, code int) {
 
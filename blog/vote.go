@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 )
 
 type VoteStar struct {
@@ -49,11 +48,7 @@ func (v *VoteStar) save() error {
 	ctx, cancel := context.WithTimeout(context.Background(), shortDuration)
 	defer cancel()
 
-	s := "star" + strconv.Itoa(v.Star)
-
-	update := `INSERT INTO poststatistics (postid,` + s + `) VALUES (?, 1)` +
-		` ON DUPLICATE KEY UPDATE ` + s + `=` + s + `+1`
-	if _, err := db.ExecContext(ctx, update, v.Id); err != nil {
+	if err := voteStore.AddVote(ctx, int64(v.Id), v.Star); err != nil {
 		return fail(err)
 	}
 
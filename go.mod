@@ -3,15 +3,22 @@ module github.com/hzget/goblog
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/alecthomas/chroma v0.10.0
 	github.com/go-redis/redis/v8 v8.11.4
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/google/uuid v1.3.0
 	github.com/hzget/analysisdriver v0.0.0-20220219141451-fcc6f80ab807
 	github.com/rs/zerolog v1.26.1
 	github.com/spf13/viper v1.10.1
+	github.com/yuin/goldmark v1.4.11
+	github.com/yuin/goldmark-highlighting v0.0.0-20220208100518-594be1970594
 	golang.org/x/crypto v0.0.0-20211215165025-cf75a172585e
-	golang.org/x/net v0.0.0-20220127200216-cd36cc0744dd // indirect
+	golang.org/x/image v0.0.0-20220302094943-723b81ca9867
+	golang.org/x/net v0.0.0-20220127200216-cd36cc0744dd
 	golang.org/x/sys v0.0.0-20220209214540-3681064d5158 // indirect
 	google.golang.org/genproto v0.0.0-20220218161850-94dd64e39d7c // indirect
 	google.golang.org/grpc v1.44.0
+	gopkg.in/yaml.v2 v2.4.0
+	modernc.org/sqlite v1.14.8
 )
@@ -16,9 +16,27 @@ package main
  */
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/hzget/goblog/blog"
 )
 
 func main() {
+
+	commands := map[string]func([]string) error{
+		"migrate":   blog.Migrate,
+		"export":    blog.Export,
+		"import":    blog.Import,
+		"import-md": blog.ImportMarkdown,
+	}
+	if len(os.Args) > 1 && commands[os.Args[1]] != nil {
+		if err := commands[os.Args[1]](os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	blog.Run(":8080")
 }
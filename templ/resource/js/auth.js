@@ -16,6 +16,7 @@
                 }
             }
             xhttp.open("POST", "./signin");
+            xhttp.setRequestHeader("X-CSRF-Token", csrfToken());
             xhttp.send(creds);
         }
         function logout(){
@@ -31,6 +32,7 @@
                 }
             }
             xhttp.open("POST", "./logout");
+            xhttp.setRequestHeader("X-CSRF-Token", csrfToken());
             xhttp.send();
         }
 
@@ -58,6 +60,7 @@
                 }
             }
             xhttp.open("POST", "./signup");
+            xhttp.setRequestHeader("X-CSRF-Token", csrfToken());
             xhttp.send(creds);
         }
 
@@ -77,10 +80,11 @@
           return "";
         }
 
+        // the session_token cookie is out of reach of the scripts,
+        // the user cookie tells who is signed in
         function checkCookie() {
-          let token = getCookie("session_token");
           let user = getCookie("user");
-          if (token != "" && user != "" && token != null && user != null) {
+          if (user != "" && user != null) {
               document.getElementById("login").setAttribute("hidden", true)
               document.getElementById("logout").removeAttribute("hidden")
               document.getElementById("welcome").innerHTML = "Welcome " + user + " !"
@@ -0,0 +1,13 @@
+        // the requests that change something send the token of the
+        // csrf_token cookie back in the X-CSRF-Token header
+        function csrfToken() {
+          let name = "csrf_token=";
+          let ca = document.cookie.split(';');
+          for (let i = 0; i < ca.length; i++) {
+            let c = ca[i].trim();
+            if (c.indexOf(name) == 0) {
+              return decodeURIComponent(c.substring(name.length));
+            }
+          }
+          return "";
+        }
@@ -38,21 +38,28 @@ type saveReq struct {
 }
 
 type viewResp struct {
-	Success  bool      `json:"success"`
-	Message  string    `json:"message"`
-	Id       int64     `json:"id"`
-	Title    string    `json:"title"`
-	Author   string    `json:"author"`
-	Date     time.Time `json:"date"`
-	Modified time.Time `json:"modified"`
-	Body     string    `json:"body"`
-	Star     [5]int    `json:"star"`
+	Success   bool      `json:"success"`
+	Message   string    `json:"message"`
+	Id        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Author    string    `json:"author"`
+	Date      time.Time `json:"date"`
+	Modified  time.Time `json:"modified"`
+	Body      string    `json:"body"`
+	Version   int64     `json:"version"`
+	Status    string    `json:"status"`
+	PublishAt time.Time `json:"publishat"`
+	Tags      []string  `json:"tags"`
+	Format    string    `json:"format"`
+	Star      [5]int    `json:"star"`
+	HTML      string    `json:"html"`
 }
 
 type saveResp struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 	Id      int64  `json:"id"`
+	Version int64  `json:"version"`
 }
 
 type Credentials struct {